@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requireAdmin guards admin endpoints with the ADMIN_TOKEN bearer token.
+// Admin endpoints are disabled entirely when no token is configured.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.AdminToken == "" {
+			http.Error(w, "Admin endpoints are disabled", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// optimizeHandler refreshes the query planner statistics with PRAGMA optimize and ANALYZE
+func optimizeHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	start := time.Now()
+	_, err := getDB().ExecContext(r.Context(), "PRAGMA optimize; ANALYZE;")
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to optimize database")
+		slog.ErrorContext(r.Context(), "Error optimizing database", "err", err)
+		return
+	}
+	elapsed := time.Since(start)
+	slog.InfoContext(r.Context(), "Database optimized", "duration_ms", elapsed.Milliseconds())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"duration_ms": elapsed.Milliseconds()})
+}
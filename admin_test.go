@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.AdminToken = "secret" })
+	createItems(t, h, "apple", "banana", "cherry")
+
+	w := serve(h, "POST", "/admin/optimize", "", "Authorization", "Bearer secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var body map[string]any
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if _, ok := body["duration_ms"].(float64); !ok {
+		t.Errorf("body %q has no duration_ms", w.Body)
+	}
+	var stats int
+	if err := getDB().QueryRow("SELECT count(*) FROM sqlite_stat1 WHERE tbl = 'items'").Scan(&stats); err != nil || stats == 0 {
+		t.Errorf("ANALYZE left no statistics for items: %d rows, err %v", stats, err)
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", "secret"} {
+		if w := serve(h, "POST", "/admin/optimize", "", "Authorization", auth); w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want 401", auth, w.Code)
+		}
+	}
+}
+
+func TestOptimizeDisabled(t *testing.T) {
+	h := setupTest(t)
+
+	if w := serve(h, "POST", "/admin/optimize", "", "Authorization", "Bearer "); w.Code != http.StatusForbidden {
+		t.Errorf("status %d, want 403 without ADMIN_TOKEN", w.Code)
+	}
+}
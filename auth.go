@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// unauthenticatedPaths stay reachable without an API key so load balancers can probe them
+var unauthenticatedPaths = map[string]bool{"/": true, "/healthz": true, "/readyz": true}
+
+// requireAPIKey rejects requests that do not present one of API_KEYS, either as
+// "Authorization: Bearer <key>" or in X-API-Key. With API_KEY_PUBLIC_READS, GET and HEAD
+// stay open and only writes need a key. /admin endpoints are guarded by ADMIN_TOKEN instead.
+// Authentication is off when no keys are configured.
+func requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case len(cfg.APIKeys) == 0,
+			unauthenticatedPaths[r.URL.Path],
+			strings.HasPrefix(r.URL.Path, "/admin/"),
+			cfg.APIKeyPublicReads && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "X-API-Key, Authorization")
+		key := r.Header.Get("X-API-Key")
+		if key == "" {
+			key, _ = strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if key == "" || !validAPIKey(key) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "missing or invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validAPIKey reports whether key matches a configured key. Every key is compared in constant
+// time so the response time does not reveal how much of a key was right or which key matched.
+func validAPIKey(key string) bool {
+	match := 0
+	for _, k := range cfg.APIKeys {
+		match |= subtle.ConstantTimeCompare([]byte(key), []byte(k))
+	}
+	return match == 1
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	h := setupTest(t, func(c *Config) {
+		c.APIKeys = []string{"secret"}
+		c.APIKeyPublicReads = true
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		headers []string
+		want    int
+	}{
+		{"no key", "POST", nil, http.StatusUnauthorized},
+		{"wrong key", "POST", []string{"X-API-Key", "guess"}, http.StatusUnauthorized},
+		{"X-API-Key", "POST", []string{"X-API-Key", "secret"}, http.StatusCreated},
+		{"bearer", "POST", []string{"Authorization", "Bearer secret"}, http.StatusConflict},
+		{"public read", "GET", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		body := ""
+		if tt.method == "POST" {
+			body = `{"name":"apple"}`
+		}
+		w := serve(h, tt.method, "/items", body, tt.headers...)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+		if vary := strings.Join(w.Header().Values("Vary"), ", "); tt.method == "POST" && !strings.Contains(vary, "X-API-Key, Authorization") {
+			t.Errorf("%s: Vary %q, want the API key headers", tt.name, vary)
+		}
+	}
+}
+
+func TestCORSPreflightAllowsAPIKey(t *testing.T) {
+	h := setupTest(t, func(c *Config) {
+		c.APIKeys = []string{"secret"}
+		c.CORSAllowedOrigins = []string{"https://app.example"}
+	})
+
+	w := serve(h, "OPTIONS", "/items", "",
+		"Origin", "https://app.example",
+		"Access-Control-Request-Method", "POST",
+		"Access-Control-Request-Headers", "x-api-key")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want 204", w.Code)
+	}
+	if allow := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(allow, "X-API-Key") {
+		t.Errorf("Access-Control-Allow-Headers %q does not list X-API-Key", allow)
+	}
+}
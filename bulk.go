@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// upsertSummary reports how many rows a bulk upsert created, restored from a soft delete, and
+// left alone because an item of that name was already live
+type upsertSummary struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// rejectIfBatchTooLarge responds with 413 and returns true when a batch exceeds MaxBatchSize.
+// Call it before opening a transaction so oversized batches never touch the database.
+func rejectIfBatchTooLarge(w http.ResponseWriter, n int) bool {
+	if n <= cfg.MaxBatchSize {
+		return false
+	}
+	http.Error(w, fmt.Sprintf("Batch of %d items exceeds the limit of %d", n, cfg.MaxBatchSize), http.StatusRequestEntityTooLarge)
+	return true
+}
+
+// bulkUpsertHandler inserts or updates a batch of items keyed by name in a single transaction
+func bulkUpsertHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	var items []Item
+	if !decodeBody(w, r, &items) {
+		return
+	}
+	if rejectIfBatchTooLarge(w, len(items)) || rejectInvalidItems(w, items) {
+		return
+	}
+	writeUpsert(r.Context(), w, items)
+}
+
+// batchCreateHandler inserts an array of new items in a single transaction, returning them with
+// their assigned ids. Any name conflict rolls the whole batch back with a 409 naming the item.
+func batchCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	var items []Item
+	if !decodeBody(w, r, &items) {
+		return
+	}
+	if rejectIfBatchTooLarge(w, len(items)) || rejectInvalidItems(w, items) {
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := getDB().BeginTx(ctx, nil)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to create items")
+		slog.ErrorContext(r.Context(), "Error beginning batch transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now, tenant := timestamp(), tenantFrom(ctx)
+	created := make([]Item, len(items))
+	for i, item := range items {
+		err := tx.QueryRowContext(ctx, "INSERT INTO items (tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?) RETURNING "+itemColumns,
+			tenant, item.Name, nameKey(item.Name), now, now).Scan(created[i].fields()...)
+		if isNameConflict(err) {
+			writeJSONError(w, http.StatusConflict, fmt.Sprintf("item name already exists: %q", item.Name))
+			return
+		}
+		if err != nil {
+			writeDBError(r.Context(), w, err, "Failed to create items")
+			slog.ErrorContext(r.Context(), "Error inserting batch item", "err", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(r.Context(), w, err, "Failed to create items")
+		slog.ErrorContext(r.Context(), "Error committing batch", "err", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// batchGetOrCreateHandler resolves an array of names to items in one transaction, returning
+// each name's existing item or creating it, in input order. A name that differs from a stored
+// one only by case or accents resolves to the stored item when canonical names are enforced.
+func batchGetOrCreateHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	var names []string
+	if !decodeBody(w, r, &names) {
+		return
+	}
+	if rejectIfBatchTooLarge(w, len(names)) {
+		return
+	}
+	for i := range names {
+		item := Item{Name: names[i]}
+		if err := validateItem(&item); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid name at index %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		names[i] = item.Name
+	}
+
+	ctx := r.Context()
+	tx, err := getDB().BeginTx(ctx, nil)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to resolve items")
+		slog.ErrorContext(r.Context(), "Error beginning get-or-create transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now, tenant := timestamp(), tenantFrom(ctx)
+	resolved := make([]Item, len(names))
+	for i, name := range names {
+		// Try the insert first; DO NOTHING covers both unique indexes, and RETURNING yields no row
+		// when the item already exists, in which case it is looked up by name and then name_key.
+		// A live item is returned as it is. One that was soft-deleted is restored, since the caller
+		// asked for it to exist, with a new updated_at so its ETag changes.
+		err := tx.QueryRowContext(ctx, "INSERT INTO items (tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?) "+
+			"ON CONFLICT DO NOTHING RETURNING "+itemColumns, tenant, name, nameKey(name), now, now).Scan(resolved[i].fields()...)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRowContext(ctx, "SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND (name = ? OR name_key = ?) ORDER BY name = ? DESC, id LIMIT 1",
+				tenant, name, nameKey(name), name).Scan(resolved[i].fields()...)
+			if err == nil && resolved[i].DeletedAt != nil {
+				err = tx.QueryRowContext(ctx, "UPDATE items SET deleted_at = NULL, updated_at = ? WHERE id = ? RETURNING "+itemColumns,
+					now, resolved[i].ID).Scan(resolved[i].fields()...)
+			}
+		}
+		if err != nil {
+			writeDBError(r.Context(), w, err, "Failed to resolve items")
+			slog.ErrorContext(r.Context(), "Error resolving item", "err", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(r.Context(), w, err, "Failed to resolve items")
+		slog.ErrorContext(r.Context(), "Error committing get-or-create", "err", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resolved)
+}
+
+// writeUpsert upserts items keyed by name in a single transaction and writes the resulting summary
+func writeUpsert(ctx context.Context, w http.ResponseWriter, items []Item) {
+	tx, err := getDB().BeginTx(ctx, nil)
+	if err != nil {
+		writeDBError(ctx, w, err, "Failed to upsert items")
+		slog.ErrorContext(ctx, "Error beginning upsert transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var summary upsertSummary
+	if !upsertInTx(ctx, w, tx, items, &summary) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(ctx, w, err, "Failed to upsert items")
+		slog.ErrorContext(ctx, "Error committing upsert", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// upsertInTx upserts items keyed by name inside tx, counting them into summary. A name is the
+// whole of an item, so only a soft-deleted one has anything to update: it is restored, while a
+// live one is left unwritten and keeps its updated_at. On failure it writes the error response
+// and returns false; the caller rolls back.
+func upsertInTx(ctx context.Context, w http.ResponseWriter, tx *sql.Tx, items []Item, summary *upsertSummary) bool {
+	now, tenant := timestamp(), tenantFrom(ctx)
+	for _, item := range items {
+		var deleted bool
+		err := tx.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM items WHERE tenant_id = ? AND name = ?", tenant, item.Name).Scan(&deleted)
+		exists := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			writeDBError(ctx, w, err, "Failed to upsert items")
+			slog.ErrorContext(ctx, "Error checking item existence", "err", err)
+			return false
+		}
+		if exists && !deleted {
+			summary.Unchanged++
+			continue
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO items (tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?) "+
+			"ON CONFLICT(tenant_id, name) DO UPDATE SET updated_at = excluded.updated_at, deleted_at = NULL",
+			tenant, item.Name, nameKey(item.Name), now, now)
+		if isNameConflict(err) {
+			writeJSONError(w, http.StatusConflict, fmt.Sprintf("item name already exists: %q", item.Name))
+			return false
+		}
+		if err != nil {
+			writeDBError(ctx, w, err, "Failed to upsert items")
+			slog.ErrorContext(ctx, "Error upserting item", "err", err)
+			return false
+		}
+		if exists {
+			summary.Updated++
+		} else {
+			summary.Inserted++
+		}
+	}
+	return true
+}
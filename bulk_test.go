@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBulkUpsertCounts(t *testing.T) {
+	h := setupTest(t)
+	serve(h, "POST", "/items", `{"name":"apple"}`)
+	serve(h, "POST", "/items", `{"name":"banana"}`)
+	serve(h, "DELETE", "/items/2", "")
+	getDB().Exec("UPDATE items SET updated_at = '2000-01-01T00:00:00Z'")
+
+	w := serve(h, "POST", "/items/bulk-upsert", `[{"name":"apple"},{"name":"banana"},{"name":"cherry"}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var got upsertSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (upsertSummary{Inserted: 1, Updated: 1, Unchanged: 1}); got != want {
+		t.Errorf("summary %+v, want %+v", got, want)
+	}
+
+	var updatedAt string
+	getDB().QueryRow("SELECT updated_at FROM items WHERE name = 'apple'").Scan(&updatedAt)
+	if updatedAt != "2000-01-01T00:00:00Z" {
+		t.Errorf("unchanged item was rewritten, updated_at %s", updatedAt)
+	}
+	getDB().QueryRow("SELECT updated_at FROM items WHERE name = 'banana' AND deleted_at IS NULL").Scan(&updatedAt)
+	if updatedAt == "2000-01-01T00:00:00Z" {
+		t.Error("restored item kept its old updated_at")
+	}
+}
+
+func TestBulkUpsertRejects(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.MaxBatchSize, c.CanonicalNames = 2, true })
+	serve(h, "POST", "/items", `{"name":"apple"}`)
+
+	if w := serve(h, "POST", "/items/bulk-upsert", `[{"name":"a"},{"name":"b"},{"name":"c"}]`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized batch: status %d, want 413", w.Code)
+	}
+	if w := serve(h, "POST", "/items/bulk-upsert", `[{"name":"kiwi"},{"name":"APPLE"}]`); w.Code != http.StatusConflict {
+		t.Errorf("canonical name conflict: status %d, want 409", w.Code)
+	}
+	if w := serve(h, "GET", "/items/by-name?name=kiwi", ""); w.Code != http.StatusNotFound {
+		t.Errorf("failed batch was not rolled back: status %d", w.Code)
+	}
+}
+
+func TestBatchCreate(t *testing.T) {
+	h := setupTest(t)
+
+	w := serve(h, "POST", "/items/batch", `[{"name":"apple"},{"name":"banana"}]`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var created []Item
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if len(created) != 2 || created[0].ID == 0 || created[1].Name != "banana" {
+		t.Errorf("created %+v", created)
+	}
+
+	w = serve(h, "POST", "/items/batch", `[{"name":"cherry"},{"name":"apple"}]`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "apple") {
+		t.Errorf("duplicate: status %d, body %q, want 409 naming apple", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/items/count", ""); !strings.Contains(w.Body.String(), `"count":2`) {
+		t.Errorf("count after rolled back batch: %q", w.Body)
+	}
+}
+
+func TestBatchGetOrCreate(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.CanonicalNames = true })
+	serve(h, "POST", "/items", `{"name":"Café"}`)
+
+	w := serve(h, "POST", "/items/batch-get-or-create", `["cafe","tea","Café"]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var resolved []Item
+	json.Unmarshal(w.Body.Bytes(), &resolved)
+	if len(resolved) != 3 || resolved[0].ID != 1 || resolved[1].Name != "tea" || resolved[2].ID != 1 {
+		t.Errorf("resolved %+v, want Café, a new tea, Café", resolved)
+	}
+}
+
+func TestBatchSizeLimit(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.MaxBatchSize = 2 })
+
+	for target, body := range map[string]string{
+		"/items/batch":                    `[{"name":"a"},{"name":"b"},{"name":"c"}]`,
+		"/items/bulk-upsert":              `[{"name":"a"},{"name":"b"},{"name":"c"}]`,
+		"/items/replace-all?confirm=true": `[{"name":"a"},{"name":"b"},{"name":"c"}]`,
+		"/items/batch-get-or-create":      `["a","b","c"]`,
+	} {
+		w := serve(h, "POST", target, body)
+		if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "limit of 2") {
+			t.Errorf("%s: status %d, body %q, want 413 stating the limit", target, w.Code, w.Body)
+		}
+	}
+	if w := serve(h, "GET", "/items/count", ""); !strings.Contains(w.Body.String(), `"count":0`) {
+		t.Errorf("rejected batches inserted rows: %q", w.Body)
+	}
+	if w := serve(h, "POST", "/items/batch", `[{"name":"a"},{"name":"b"}]`); w.Code != http.StatusCreated {
+		t.Errorf("batch at the limit: status %d, body %q", w.Code, w.Body)
+	}
+}
+
+func TestBatchGetOrCreateOrder(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "banana", "apple", "damson")
+	serve(h, "DELETE", "/items/3", "")
+	getDB().Exec("UPDATE items SET updated_at = '2000-01-01T00:00:00Z'")
+
+	w := serve(h, "POST", "/items/batch-get-or-create", `["cherry","apple","elder","banana","damson","cherry"]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var resolved []Item
+	json.Unmarshal(w.Body.Bytes(), &resolved)
+	var got []string
+	for _, item := range resolved {
+		got = append(got, item.Name)
+	}
+	if want := []string{"cherry", "apple", "elder", "banana", "damson", "cherry"}; !slices.Equal(got, want) {
+		t.Fatalf("resolved %q, want %q", got, want)
+	}
+	// Existing names keep their ids, the deleted damson is restored, and a repeated new name
+	// resolves to the item its first occurrence created
+	if resolved[1].ID != 2 || resolved[3].ID != 1 || resolved[4].ID != 3 || resolved[4].DeletedAt != nil {
+		t.Errorf("existing items resolved to %+v", resolved)
+	}
+	// Only the restored item is written; live ones keep their updated_at and so their ETag
+	if resolved[1].UpdatedAt != "2000-01-01T00:00:00Z" || resolved[3].UpdatedAt != "2000-01-01T00:00:00Z" {
+		t.Errorf("live items were rewritten: %+v", resolved)
+	}
+	if resolved[4].UpdatedAt == "2000-01-01T00:00:00Z" {
+		t.Error("restored item kept its old updated_at")
+	}
+	if resolved[0].ID <= 3 || resolved[0].ID != resolved[5].ID || resolved[2].ID <= 3 || resolved[2].ID == resolved[0].ID {
+		t.Errorf("new items resolved to %+v", resolved)
+	}
+
+	// An invalid name rejects the whole batch before anything is created
+	if w := serve(h, "POST", "/items/batch-get-or-create", `["fig",""]`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid name: status %d, want 400", w.Code)
+	}
+	if w := serve(h, "GET", "/items/by-name?name=fig", ""); w.Code != http.StatusNotFound {
+		t.Errorf("rejected batch created fig: status %d", w.Code)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompressResponses(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.GzipMinBytes = 1024 })
+	for i := range 50 {
+		createItems(t, h, fmt.Sprintf("item-%d", i))
+	}
+
+	plain := serve(h, "GET", "/items", "")
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("compressed without Accept-Encoding")
+	}
+	w := serve(h, "GET", "/items", "", "Accept-Encoding", "gzip, deflate")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" {
+		t.Fatalf("Content-Encoding %q, Content-Length %q, want gzip without a length", w.Header().Get("Content-Encoding"), w.Header().Get("Content-Length"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != plain.Body.String() {
+		t.Errorf("decoded gzip body differs from the uncompressed one:\n%s\n%s", decoded, plain.Body)
+	}
+
+	tests := []struct {
+		name, target, encoding string
+	}{
+		{"under the threshold", "/items/1", "gzip"},
+		{"refused with q=0", "/items", "gzip;q=0"},
+		{"other coding", "/items", "br"},
+	}
+	for _, tt := range tests {
+		w := serve(h, "GET", tt.target, "", "Accept-Encoding", tt.encoding)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: status %d, Content-Encoding %q, want uncompressed", tt.name, w.Code, w.Header().Get("Content-Encoding"))
+		}
+	}
+}
+
+func TestCompressSkipsCompressedTypes(t *testing.T) {
+	cfg = envConfig()
+	cfg.GzipMinBytes = 16
+	body := make([]byte, 4096)
+	for _, contentType := range []string{"image/png", "application/zip", "application/gzip"} {
+		h := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Write(body)
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.Len() != len(body) {
+			t.Errorf("%s: Content-Encoding %q, %d bytes, want it sent as is", contentType, w.Header().Get("Content-Encoding"), w.Body.Len())
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"gzip", true},
+		{"deflate, GZIP;q=0.5", true},
+		{"*", true},
+		{"gzip;q=0", false},
+		{"br", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.header)
+		if got := acceptsGzip(r); got != tt.want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
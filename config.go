@@ -0,0 +1,257 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime settings read from the environment
+type Config struct {
+	Addr                  string         // Listen address as host:port
+	DatabaseURL           string         // Primary database path or sqlite: URL (see parseDSN)
+	LogLevel              slog.Level     // Minimum level written by the JSON logger
+	ManageSchema          bool           // Create and migrate the schema at startup; when off, only verify it
+	SecondaryDBPath       string         // Read-only fallback database, empty disables failover
+	FailoverProbeInterval time.Duration  // How often the primary database is probed
+	MinFreeDiskBytes      uint64         // Readiness fails when the DB filesystem has less free space
+	DiskFullWebhook       string         // URL POSTed a JSON alert when writes fail on a full disk, empty disables
+	DiskFullAlertInterval time.Duration  // Minimum time between two disk-full webhook alerts
+	PanicWebhook          string         // URL POSTed a JSON report of each panic a handler raises, empty disables
+	MaxBodyBytes          int64          // Largest request body accepted, larger ones get 413
+	MaxJSONDepth          int            // Maximum nesting of objects/arrays in a request body
+	MaxJSONTokens         int            // Maximum number of JSON tokens in a request body
+	MaxBatchSize          int            // Maximum number of items accepted by batch endpoints
+	MaxNameLength         int            // Longest item name accepted, in characters, after trimming whitespace
+	AllowClientIDs        bool           // Let POST /items insert with an id supplied in the body
+	MaxQueryLength        int            // Maximum length in bytes of the raw URL query string
+	MaxQueryParams        int            // Maximum number of query string parameters
+	CacheControlList      string         // Cache-Control for the item list
+	CacheControlItem      string         // Cache-Control for single-item reads
+	CacheControlMutation  string         // Cache-Control for create/update/delete responses
+	AdminToken            string         // Bearer token for /admin endpoints, empty disables them
+	CanonicalNames        bool           // Enforce uniqueness on the case/accent-folded name_key
+	DBHealthInterval      time.Duration  // How often the connection monitor pings the database
+	DBHealthMaxFailures   int            // Consecutive failed pings before the database is reopened
+	RetryAfterMin         int            // Lower bound in seconds for Retry-After on 429/503
+	RetryAfterMax         int            // Upper bound in seconds for Retry-After on 429/503
+	ImportTimeout         time.Duration  // Deadline for fetching a remote import source
+	ImportMaxBytes        int64          // Maximum size of a remote import source
+	ImportAllowPrivate    bool           // Permit imports from loopback/private addresses (local testing only)
+	AutocompleteLimit     int            // Maximum results returned for ?name_prefix= lookups
+	ResponseBufferMax     int            // Largest list response buffered to send Content-Length, 0 disables
+	NameLookupNoCase      bool           // Match /items/by-name on the case/accent-folded name_key
+	H2C                   bool           // Serve HTTP/2 cleartext alongside HTTP/1.1
+	StrictAccept          bool           // Answer 406 when the Accept header rules out every offered type
+	ShutdownTimeout       time.Duration  // How long in-flight requests may drain on SIGINT/SIGTERM
+	DBMaxOpenConns        int            // Maximum pooled database connections, 0 means unlimited
+	DBMaxIdleConns        int            // Connections kept open while idle
+	DBConnMaxIdleTime     time.Duration  // Idle connections older than this are closed
+	FDHeadroom            int            // File descriptors to keep free beyond the database pool, for client sockets
+	RequestTimeout        time.Duration  // Deadline for a request's database work
+	ListQueryTimeout      time.Duration  // Deadline for the GET /items queries, answered with 503 when exceeded
+	HeaderReadTimeout     time.Duration  // Time a client has to send the request headers
+	BodyReadTimeout       time.Duration  // Time a client has to send the request body
+	CORSAllowedOrigins    []string       // Origins allowed to call the API from a browser, "*" for any; empty disables CORS
+	Timezone              *time.Location // Zone defining "today" and "this week" for date filters
+	APIKeys               []string       // Keys accepted by requireAPIKey, empty disables API key auth
+	APIKeyPublicReads     bool           // Let GET/HEAD through without a key; writes still need one
+	RateLimitRPS          int            // Sustained requests per second allowed per client IP, 0 disables
+	RateLimitBurst        int            // Requests a client IP may make at once before being limited
+	RateLimitIdleTTL      time.Duration  // Idle time after which a client IP's bucket is forgotten
+	RateLimitRoutes       routeLimits    // Limits for individual route patterns, overriding RATE_LIMIT_RPS/BURST
+	TrustedProxyHops      int            // Proxies in front of the server whose X-Forwarded-For is trusted
+	GzipMinBytes          int            // Smallest response gzipped for clients that accept it, 0 disables
+	MethodOverride        bool           // Let POST carry PUT/PATCH/DELETE in X-HTTP-Method-Override or ?_method=
+	TenantRequired        bool           // Reject requests that name no tenant instead of using the default one
+	TenantDomain          string         // Parent domain whose subdomains name tenants, e.g. api.example.com; empty disables
+}
+
+var cfg Config
+
+// envConfig builds a Config from environment variables, falling back to defaults
+func envConfig() Config {
+	return Config{
+		Addr:                  envString("ADDR", "0.0.0.0:8080"),
+		DatabaseURL:           envString("DB_PATH", envString("DATABASE_URL", "api.db")),
+		LogLevel:              envLevel("LOG_LEVEL", slog.LevelInfo),
+		ManageSchema:          envBool("MANAGE_SCHEMA", true),
+		SecondaryDBPath:       envString("SECONDARY_DB_PATH", ""),
+		FailoverProbeInterval: envDuration("FAILOVER_PROBE_INTERVAL", 5*time.Second),
+		MinFreeDiskBytes:      uint64(envInt("MIN_FREE_DISK_MB", 100)) << 20,
+		DiskFullWebhook:       envString("DISK_FULL_WEBHOOK", ""),
+		DiskFullAlertInterval: envDuration("DISK_FULL_ALERT_INTERVAL", 5*time.Minute),
+		PanicWebhook:          envString("PANIC_WEBHOOK", ""),
+		MaxBodyBytes:          int64(envInt("MAX_BODY_BYTES", 1<<20)),
+		MaxJSONDepth:          envInt("MAX_JSON_DEPTH", 32),
+		MaxJSONTokens:         envInt("MAX_JSON_TOKENS", 10000),
+		MaxBatchSize:          envInt("MAX_BATCH_SIZE", 1000),
+		MaxNameLength:         envInt("MAX_NAME_LENGTH", 255),
+		AllowClientIDs:        envBool("ALLOW_CLIENT_IDS", false),
+		MaxQueryLength:        envInt("MAX_QUERY_LENGTH", 2048),
+		MaxQueryParams:        envInt("MAX_QUERY_PARAMS", 32),
+		CacheControlList:      envString("CACHE_CONTROL_LIST", "private, max-age=60"),
+		CacheControlItem:      envString("CACHE_CONTROL_ITEM", "no-cache"),
+		CacheControlMutation:  envString("CACHE_CONTROL_MUTATION", "no-store"),
+		AdminToken:            envString("ADMIN_TOKEN", ""),
+		CanonicalNames:        envBool("CANONICAL_NAMES", false),
+		DBHealthInterval:      envDuration("DB_HEALTH_INTERVAL", 10*time.Second),
+		DBHealthMaxFailures:   envInt("DB_HEALTH_MAX_FAILURES", 3),
+		RetryAfterMin:         envInt("RETRY_AFTER_MIN", 5),
+		RetryAfterMax:         envInt("RETRY_AFTER_MAX", 15),
+		ImportTimeout:         envDuration("IMPORT_TIMEOUT", 10*time.Second),
+		ImportMaxBytes:        int64(envInt("IMPORT_MAX_MB", 10)) << 20,
+		ImportAllowPrivate:    envBool("IMPORT_ALLOW_PRIVATE", false),
+		AutocompleteLimit:     envInt("AUTOCOMPLETE_LIMIT", 10),
+		ResponseBufferMax:     envInt("RESPONSE_BUFFER_MAX_BYTES", 1<<20),
+		NameLookupNoCase:      envBool("NAME_LOOKUP_CASE_INSENSITIVE", false),
+		H2C:                   envBool("H2C", false),
+		StrictAccept:          envBool("STRICT_ACCEPT", false),
+		ShutdownTimeout:       envDuration("SHUTDOWN_TIMEOUT", 10*time.Second),
+		DBMaxOpenConns:        envInt("DB_MAX_OPEN_CONNS", 8),
+		DBMaxIdleConns:        envInt("DB_MAX_IDLE_CONNS", 4),
+		DBConnMaxIdleTime:     envDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+		FDHeadroom:            envInt("FD_HEADROOM", 256),
+		RequestTimeout:        envDuration("REQUEST_TIMEOUT", 5*time.Second),
+		ListQueryTimeout:      envDuration("LIST_QUERY_TIMEOUT", 3*time.Second),
+		HeaderReadTimeout:     envDuration("HEADER_READ_TIMEOUT", 5*time.Second),
+		BodyReadTimeout:       envDuration("BODY_READ_TIMEOUT", 5*time.Second),
+		CORSAllowedOrigins:    envList("CORS_ALLOWED_ORIGINS"),
+		Timezone:              envLocation("TIMEZONE", time.UTC),
+		APIKeys:               envList("API_KEYS"),
+		APIKeyPublicReads:     envBool("API_KEY_PUBLIC_READS", false),
+		RateLimitRPS:          envInt("RATE_LIMIT_RPS", 10),
+		RateLimitBurst:        envInt("RATE_LIMIT_BURST", 20),
+		RateLimitIdleTTL:      envDuration("RATE_LIMIT_IDLE_TTL", 3*time.Minute),
+		RateLimitRoutes:       envRouteLimits("RATE_LIMIT_ROUTES"),
+		TrustedProxyHops:      envInt("TRUSTED_PROXY_HOPS", 0),
+		GzipMinBytes:          envInt("GZIP_MIN_BYTES", 1024),
+		MethodOverride:        envBool("METHOD_OVERRIDE", false),
+		TenantRequired:        envBool("TENANT_REQUIRED", false),
+		TenantDomain:          envString("TENANT_DOMAIN", ""),
+	}
+}
+
+// loadConfig populates cfg from the environment and command-line flags, and validates it
+func loadConfig() {
+	cfg = envConfig()
+
+	// Flags override the environment so one-off runs need no exported variables
+	flag.StringVar(&cfg.Addr, "addr", cfg.Addr, "listen address as host:port (env ADDR)")
+	flag.StringVar(&cfg.DatabaseURL, "db", cfg.DatabaseURL, "database path or sqlite: URL (env DB_PATH)")
+	flag.BoolVar(&cfg.APIKeyPublicReads, "public-reads", cfg.APIKeyPublicReads, "require an API key only for writes (env API_KEY_PUBLIC_READS)")
+	flag.Parse()
+
+	if _, port, err := net.SplitHostPort(cfg.Addr); err != nil || port == "" {
+		fatal("Invalid listen address, expected host:port", "addr", cfg.Addr)
+	}
+	if cfg.RetryAfterMax < cfg.RetryAfterMin {
+		fatal("RETRY_AFTER_MAX must not be less than RETRY_AFTER_MIN", "retry_after_min", cfg.RetryAfterMin, "retry_after_max", cfg.RetryAfterMax)
+	}
+}
+
+// envString returns the value of the environment variable key, or def if it is unset
+func envString(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+// envList splits the comma-separated environment variable key into its non-empty, trimmed entries
+func envList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// envRouteLimits parses the environment variable key as a comma-separated list of
+// "<route pattern>=<rps>:<burst>" entries, e.g. "GET /items=50:100,POST /items/search/advanced=2:5".
+// Patterns must be written exactly as registered on the mux.
+func envRouteLimits(key string) routeLimits {
+	limits := routeLimits{}
+	for _, entry := range envList(key) {
+		pattern, spec, ok := strings.Cut(entry, "=")
+		rps, burst, ok2 := strings.Cut(spec, ":")
+		r, err := strconv.Atoi(strings.TrimSpace(rps))
+		b, err2 := strconv.Atoi(strings.TrimSpace(burst))
+		if !ok || !ok2 || err != nil || err2 != nil || r < 0 || b < 0 {
+			fatal("Invalid route rate limit, expected <pattern>=<rps>:<burst>", "key", key, "value", entry)
+		}
+		limits[strings.TrimSpace(pattern)] = routeLimit{RPS: r, Burst: b}
+	}
+	return limits
+}
+
+// envBool parses the environment variable key as a boolean, or returns def if it is unset
+func envBool(key string, def bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		fatal("Invalid boolean", "key", key, "value", v)
+	}
+	return b
+}
+
+// envInt parses the environment variable key as a non-negative integer, or returns def if it is unset
+func envInt(key string, def int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		fatal("Invalid integer", "key", key, "value", v)
+	}
+	return n
+}
+
+// envLevel parses the environment variable key as a slog level (debug, info, warn, error), or returns def if it is unset
+func envLevel(key string, def slog.Level) slog.Level {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(v)); err != nil {
+		fatal("Invalid log level", "key", key, "value", v)
+	}
+	return level
+}
+
+// envLocation loads the environment variable key as an IANA time zone name, or returns def if it is unset
+func envLocation(key string, def *time.Location) *time.Location {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		fatal("Invalid time zone", "key", key, "value", v)
+	}
+	return loc
+}
+
+// envDuration parses the environment variable key as a time.Duration, or returns def if it is unset
+func envDuration(key string, def time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		fatal("Invalid duration", "key", key, "value", v)
+	}
+	return d
+}
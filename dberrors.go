@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteCode returns the extended SQLite result code carried by err, or 0 if err did not come from SQLite
+func sqliteCode(err error) int {
+	var se *sqlite.Error
+	if errors.As(err, &se) {
+		return se.Code()
+	}
+	return 0
+}
+
+// errToStatus maps an error from a database call to a status code the client can act on.
+// The request's own deadline expiring is a gateway timeout, SQLite giving up on a lock is a
+// retryable 503, and a full disk is 507; anything else is a 500.
+func errToStatus(err error) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	}
+	switch sqliteCode(err) & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return http.StatusServiceUnavailable
+	case sqlite3.SQLITE_FULL:
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
+
+// writeDBError responds to a failed database call with the status chosen by errToStatus.
+// msg is used for unclassified failures, which remain a generic 500. A full disk also raises
+// an alert, see alertDiskFull.
+func writeDBError(ctx context.Context, w http.ResponseWriter, err error, msg string) {
+	switch status := errToStatus(err); status {
+	case http.StatusGatewayTimeout:
+		http.Error(w, "Request timed out", status)
+	case http.StatusServiceUnavailable:
+		if errors.Is(err, context.Canceled) {
+			http.Error(w, "Request canceled", status)
+			return
+		}
+		setRetryAfter(w)
+		http.Error(w, "Database is busy, retry later", status)
+	case http.StatusInsufficientStorage:
+		slog.ErrorContext(ctx, "ALERT: database or disk is full, writes are failing", "err", err)
+		alertDiskFull(ctx, err)
+		http.Error(w, "Insufficient storage: the database or disk is full", status)
+	default:
+		http.Error(w, msg, status)
+	}
+}
+
+// alertClient posts disk-full alerts; the timeout keeps a slow receiver from piling up goroutines
+var alertClient = &http.Client{Timeout: 5 * time.Second}
+
+// lastDiskFullAlert is the Unix nanoseconds of the last webhook alert, 0 before the first
+var lastDiskFullAlert atomic.Int64
+
+// alertDiskFull POSTs a JSON alert about err to DISK_FULL_WEBHOOK in the background, at most
+// once per DISK_FULL_ALERT_INTERVAL, since every write fails the same way until space is freed.
+// The alert carries the failing request's traceparent; it is sent after the request has ended,
+// so it keeps the request's values but not its cancellation.
+func alertDiskFull(ctx context.Context, err error) {
+	if cfg.DiskFullWebhook == "" {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := lastDiskFullAlert.Load()
+	if last != 0 && now-last < int64(cfg.DiskFullAlertInterval) || !lastDiskFullAlert.CompareAndSwap(last, now) {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"service": serviceName,
+		"alert":   "database or disk is full, writes are failing",
+		"error":   err.Error(),
+		"time":    timestamp(),
+	})
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.DiskFullWebhook, bytes.NewReader(body))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to build disk full alert", "err", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if t, ok := traceFrom(ctx); ok {
+			req.Header.Set("traceparent", t.traceparent())
+		}
+		resp, err := alertClient.Do(req)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to send disk full alert", "err", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.ErrorContext(ctx, "Disk full alert was rejected", "status", resp.StatusCode)
+		}
+	}()
+}
+
+// isNameConflict reports whether err is a unique violation on the item name or its canonical
+// name_key. SQLite names the violated column in the message, and either index may fire first
+// for an exact duplicate, so both are treated as the same conflict.
+func isNameConflict(err error) bool {
+	return sqliteCode(err) == sqlite3.SQLITE_CONSTRAINT_UNIQUE && strings.Contains(err.Error(), "items.name")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// busyError returns the error SQLite gives a writer that times out waiting for another's lock
+func busyError(t *testing.T) error {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "busy.db") + "?_pragma=busy_timeout(10)&_txlock=immediate"
+	holder, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	waiter, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer waiter.Close()
+
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	_, err = waiter.Exec("CREATE TABLE t (x)")
+	if err == nil {
+		t.Fatal("write succeeded while another connection held the lock")
+	}
+	return err
+}
+
+func TestErrToStatus(t *testing.T) {
+	setupTest(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, deadlineErr := getDB().QueryContext(ctx, "SELECT 1")
+
+	tests := []struct {
+		name       string
+		err        error
+		want       int
+		retryAfter bool
+	}{
+		{"request deadline", context.DeadlineExceeded, http.StatusGatewayTimeout, false},
+		{"request deadline from the driver", deadlineErr, http.StatusGatewayTimeout, false},
+		{"client canceled", fmt.Errorf("query: %w", context.Canceled), http.StatusServiceUnavailable, false},
+		{"busy timeout", busyError(t), http.StatusServiceUnavailable, true},
+		{"other", fmt.Errorf("something else"), http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		if got := errToStatus(tt.err); got != tt.want {
+			t.Errorf("%s: errToStatus(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+		w := httptest.NewRecorder()
+		writeDBError(context.Background(), w, tt.err, "Failed")
+		if w.Code != tt.want || (w.Header().Get("Retry-After") != "") != tt.retryAfter {
+			t.Errorf("%s: writeDBError sent %d with Retry-After %q", tt.name, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+// capDatabase caps the database at its current size on a single connection, so the next page it
+// needs fails with SQLITE_FULL as a full disk would
+func capDatabase(t *testing.T) {
+	t.Helper()
+	db := getDB()
+	db.SetMaxOpenConns(1)
+	var pages int
+	db.QueryRow("PRAGMA page_count").Scan(&pages)
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA max_page_count = %d", pages)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiskFull(t *testing.T) {
+	alerts := make(chan map[string]string, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert map[string]string
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer webhook.Close()
+
+	h := setupTest(t, func(c *Config) {
+		c.DiskFullWebhook = webhook.URL
+		c.DiskFullAlertInterval = time.Hour
+	})
+	lastDiskFullAlert.Store(0)
+	capDatabase(t)
+
+	full := 0
+	for i := 0; i < 200 && full < 2; i++ {
+		w := serve(h, "POST", "/items", fmt.Sprintf(`{"name":"%s-%d"}`, strings.Repeat("x", 200), i))
+		switch w.Code {
+		case http.StatusCreated:
+		case http.StatusInsufficientStorage:
+			full++
+			if !strings.Contains(w.Body.String(), "full") {
+				t.Errorf("507 body %q does not say the storage is full", w.Body)
+			}
+		default:
+			t.Fatalf("insert %d: status %d, body %q", i, w.Code, w.Body)
+		}
+	}
+	if full < 2 {
+		t.Fatal("inserts never failed with 507")
+	}
+
+	select {
+	case alert := <-alerts:
+		if alert["service"] != serviceName || !strings.Contains(alert["error"], "full") {
+			t.Errorf("alert %v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook alert was sent")
+	}
+	select {
+	case alert := <-alerts:
+		t.Errorf("second alert within DISK_FULL_ALERT_INTERVAL: %v", alert)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
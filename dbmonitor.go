@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	dbLastHealthy atomic.Int64 // Unix nanoseconds of the last successful health probe
+	dbReconnects  atomic.Int64 // Number of times the primary handle has been reopened
+)
+
+// monitorConnection probes the primary database periodically and, after
+// cfg.DBHealthMaxFailures consecutive failures, reopens it and swaps the new
+// handle in so requests pick it up on their next query. A database file
+// replaced on disk counts as a failure, see probePrimary.
+func monitorConnection(stop <-chan struct{}) {
+	dbLastHealthy.Store(time.Now().UnixNano())
+	ticker := time.NewTicker(cfg.DBHealthInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		// While failed over, the failover monitor owns the primary handle
+		if failedOver.Load() {
+			continue
+		}
+
+		err := probePrimary()
+		if err == nil {
+			dbLastHealthy.Store(time.Now().UnixNano())
+			failures = 0
+			continue
+		}
+		failures++
+		slog.Warn("Database health probe failed", "failures", failures, "max_failures", cfg.DBHealthMaxFailures, "err", err)
+		if failures < cfg.DBHealthMaxFailures {
+			continue
+		}
+
+		if err := reopenPrimary(); err != nil {
+			slog.Error("Failed to reopen database", "err", err)
+			continue
+		}
+		failures = 0
+		dbReconnects.Add(1)
+		dbLastHealthy.Store(time.Now().UnixNano())
+		slog.Info("Database connection reopened after repeated health probe failures")
+	}
+}
+
+// statsHandler reports connection health and pool statistics
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := getDB().Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"db_last_healthy":     time.Unix(0, dbLastHealthy.Load()).UTC().Format(time.RFC3339),
+		"db_reconnects":       dbReconnects.Load(),
+		"db_failed_over":      failedOver.Load(),
+		"db_open_connections": stats.OpenConnections,
+		"db_in_use":           stats.InUse,
+		"db_idle":             stats.Idle,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startMonitor runs monitorConnection with a short interval until the test ends
+func startMonitor(t *testing.T) {
+	t.Helper()
+	cfg.DBHealthInterval = 10 * time.Millisecond
+	cfg.DBHealthMaxFailures = 2
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		monitorConnection(stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+}
+
+// waitForReconnect waits until dbReconnects has moved past before
+func waitForReconnect(t *testing.T, before int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for dbReconnects.Load() == before {
+		if time.Now().After(deadline) {
+			t.Fatal("monitor did not reopen the database")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMonitorReopensClosedDB(t *testing.T) {
+	h := setupTest(t)
+	startMonitor(t)
+	before := dbReconnects.Load()
+
+	primaryDB.Load().Close()
+	waitForReconnect(t, before)
+
+	if w := serve(h, "GET", "/items", ""); w.Code != http.StatusOK {
+		t.Errorf("after reopen: status %d, want 200", w.Code)
+	}
+}
+
+func TestMonitorReopensReplacedFile(t *testing.T) {
+	h := setupTest(t)
+	serve(h, "POST", "/items", `{"name":"apple"}`)
+
+	// Snapshot the database, then write to it some more and put the snapshot in its place. The
+	// pooled connections still hold the old file and would keep serving banana.
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	if _, err := getDB().Exec("VACUUM INTO ?", snapshot); err != nil {
+		t.Fatal(err)
+	}
+	serve(h, "POST", "/items", `{"name":"banana"}`)
+	// A restore removes the write-ahead log too, or SQLite would replay it into the new file
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(primaryPath + suffix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Rename(snapshot, primaryPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := probePrimary(); err != errPrimaryReplaced {
+		t.Fatalf("probePrimary = %v, want errPrimaryReplaced", err)
+	}
+
+	before := dbReconnects.Load()
+	startMonitor(t)
+	waitForReconnect(t, before)
+
+	if w := serve(h, "GET", "/items/by-name?name=banana", ""); w.Code != http.StatusNotFound {
+		t.Errorf("item written to the replaced file: status %d, want 404", w.Code)
+	}
+	if w := serve(h, "GET", "/items/by-name?name=apple", ""); w.Code != http.StatusOK {
+		t.Errorf("item in the new file: status %d, want 200", w.Code)
+	}
+	if err := probePrimary(); err != nil {
+		t.Errorf("probePrimary after reopen = %v", err)
+	}
+}
+
+func TestReopenPrimaryKeepsMissingFile(t *testing.T) {
+	setupTest(t)
+	if err := os.Remove(primaryPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopenPrimary(); err == nil {
+		t.Fatal("reopenPrimary succeeded with the database file missing")
+	}
+	if _, err := os.Stat(primaryPath); !os.IsNotExist(err) {
+		t.Errorf("reopenPrimary created %s", primaryPath)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var errJSONTooComplex = errors.New("JSON too complex")
+
+// decodeBody decodes the JSON request body into v, writing a 400 and returning false on failure.
+// Bodies over MAX_BODY_BYTES are cut off with 413 before they are buffered, and fields v does not
+// have are rejected so a misspelt key is not silently ignored.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		http.Error(w, "Timed out reading request body", http.StatusRequestTimeout)
+		return false
+	}
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return false
+	}
+	if err := checkJSONComplexity(body); err != nil {
+		http.Error(w, "Invalid request body: "+describeJSONError(err, body), http.StatusBadRequest)
+		return false
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		http.Error(w, "Invalid request body: "+describeJSONError(err, body), http.StatusBadRequest)
+		return false
+	}
+	if dec.More() {
+		http.Error(w, fmt.Sprintf("Invalid request body: unexpected data after JSON value at offset %d", dec.InputOffset()), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// describeJSONError explains a decoding failure with the byte offset where it occurred and,
+// for a value of the wrong type, the field and the type that was expected
+func describeJSONError(err error, body []byte) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Sprintf("%s at offset %d", syntaxErr, syntaxErr.Offset)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return fmt.Sprintf("%q: expected %s but got %s at offset %d", typeErr.Field, typeErr.Type, typeErr.Value, typeErr.Offset)
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("expected %s but got %s at offset %d", typeErr.Type, typeErr.Value, typeErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return fmt.Sprintf("unexpected end of JSON input at offset %d", len(body))
+	}
+	// DisallowUnknownFields reports `json: unknown field "x"` without a dedicated error type
+	return strings.TrimPrefix(err.Error(), "json: ")
+}
+
+// checkJSONComplexity streams through the tokens of body and fails once the nesting
+// depth or total token count exceeds the configured limits, before anything is allocated
+// for the decoded value
+func checkJSONComplexity(body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	depth, tokens := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		tokens++
+		if tokens > cfg.MaxJSONTokens {
+			return fmt.Errorf("%w: more than %d tokens", errJSONTooComplex, cfg.MaxJSONTokens)
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+			if depth > cfg.MaxJSONDepth {
+				return fmt.Errorf("%w: nesting deeper than %d", errJSONTooComplex, cfg.MaxJSONDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
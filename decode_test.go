@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBodyComplexity(t *testing.T) {
+	h := setupTest(t, func(c *Config) {
+		c.MaxJSONDepth = 8
+		c.MaxJSONTokens = 100
+	})
+
+	nested := func(depth int) string {
+		return `{"name":` + strings.Repeat("[", depth-1) + strings.Repeat("]", depth-1) + `}`
+	}
+	tokens := `{"name":[` + strings.Repeat(`1,`, 200) + `1]}`
+
+	tests := []struct {
+		name, target, body string
+		want               int
+		wantErr            string
+	}{
+		{"at depth limit", "/items", nested(8), http.StatusBadRequest, `"name": expected string`},
+		{"too deep", "/items", nested(9), http.StatusBadRequest, "JSON too complex"},
+		{"bomb", "/items", nested(10000), http.StatusBadRequest, "JSON too complex"},
+		{"too many tokens", "/items", tokens, http.StatusBadRequest, "JSON too complex"},
+		{"batch", "/items/batch", `[` + nested(9) + `]`, http.StatusBadRequest, "JSON too complex"},
+		{"resource", "/tags", `{"label":` + strings.Repeat("[", 9) + strings.Repeat("]", 9) + `}`, http.StatusBadRequest, "JSON too complex"},
+		{"valid", "/items", `{"name":"apple"}`, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		w := serve(h, "POST", tt.target, tt.body)
+		if w.Code != tt.want || !strings.Contains(w.Body.String(), tt.wantErr) {
+			t.Errorf("%s: status %d, body %q, want %d with %q", tt.name, w.Code, w.Body, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDecodeBodyTooLarge(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.MaxBodyBytes = 64 })
+
+	if w := serve(h, "POST", "/items", `{"name":"`+strings.Repeat("a", 100)+`"}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413, body %q", w.Code, w.Body)
+	}
+}
+
+func TestDecodeBodyErrors(t *testing.T) {
+	h := setupTest(t)
+
+	tests := []struct {
+		name, body, want string
+	}{
+		{"truncated", `{"name":"app`, "unexpected end of JSON input at offset 12"},
+		{"wrong type", `{"name": 12}`, `"name": expected string but got number at offset 11`},
+		{"syntax", `{"name" "apple"}`, "at offset 9"},
+		{"unknown field", `{"name":"apple","colour":"red"}`, `unknown field "colour"`},
+		{"trailing data", `{"name":"apple"} {}`, "unexpected data after JSON value at offset 17"},
+	}
+	for _, tt := range tests {
+		w := serve(h, "POST", "/items", tt.body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: status %d, body %q, want 400 with %q", tt.name, w.Code, w.Body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// fieldDiff compares one field of the two items passed to /items/diff
+type fieldDiff struct {
+	A       any  `json:"a"`
+	B       any  `json:"b"`
+	Changed bool `json:"changed"`
+}
+
+// diffItemsHandler compares two items field by field: GET /items/diff?a=1&b=2
+func diffItemsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var ids [2]int
+	for i, key := range []string{"a", "b"} {
+		id, err := parseIDParam(q, key)
+		if err == nil && id == 0 {
+			err = fmt.Errorf("%s is required", key)
+		}
+		if err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		ids[i] = id
+	}
+
+	var items [2]Item
+	for i, id := range ids {
+		err := getDB().QueryRowContext(r.Context(), "SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL", tenantFrom(r.Context()), id).
+			Scan(items[i].fields()...)
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Item %d not found", id), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeDBError(r.Context(), w, err, "Failed to retrieve item")
+			slog.ErrorContext(r.Context(), "Error querying item for diff", "err", err)
+			return
+		}
+	}
+
+	a, b := items[0], items[1]
+	writeJSON(w, http.StatusOK, map[string]fieldDiff{
+		"id":         {A: a.ID, B: b.ID, Changed: a.ID != b.ID},
+		"name":       {A: a.Name, B: b.Name, Changed: a.Name != b.Name},
+		"created_at": {A: a.CreatedAt, B: b.CreatedAt, Changed: a.CreatedAt != b.CreatedAt},
+		"updated_at": {A: a.UpdatedAt, B: b.UpdatedAt, Changed: a.UpdatedAt != b.UpdatedAt},
+	})
+}
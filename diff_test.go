@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestDiffItems(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple", "banana")
+	getDB().Exec("UPDATE items SET created_at = '2024-01-01T00:00:00Z', updated_at = '2024-01-02T00:00:00Z'")
+	getDB().Exec("UPDATE items SET updated_at = '2024-03-01T00:00:00Z' WHERE id = 2")
+
+	w := serve(h, "GET", "/items/diff?a=1&b=2", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var got map[string]fieldDiff
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]fieldDiff{
+		"id":         {A: 1.0, B: 2.0, Changed: true},
+		"name":       {A: "apple", B: "banana", Changed: true},
+		"created_at": {A: "2024-01-01T00:00:00Z", B: "2024-01-01T00:00:00Z", Changed: false},
+		"updated_at": {A: "2024-01-02T00:00:00Z", B: "2024-03-01T00:00:00Z", Changed: true},
+	}
+	for field, wantDiff := range want {
+		if got[field] != wantDiff {
+			t.Errorf("%s: %+v, want %+v", field, got[field], wantDiff)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"a=1&b=1", http.StatusOK},
+		{"a=1&b=9", http.StatusNotFound},
+		{"a=9&b=1", http.StatusNotFound},
+		{"a=1", http.StatusBadRequest},
+		{"a=x&b=1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := serve(h, "GET", "/items/diff?"+tt.query, ""); w.Code != tt.want {
+			t.Errorf("?%s: status %d, want %d", tt.query, w.Code, tt.want)
+		}
+	}
+}
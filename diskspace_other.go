@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+// diskFreeBytes is not implemented on this platform, so readiness skips the disk check
+func diskFreeBytes(path string) (uint64, error) {
+	return 0, errDiskUsageUnsupported
+}
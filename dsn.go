@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// memoryDSN names a shared in-memory database so every pooled connection sees the same data
+const memoryDSN = "file:simplerest?mode=memory&cache=shared"
+
+// parseDSN turns DATABASE_URL into the file path used for health checks and the DSN handed to
+// the driver. It accepts a bare path, sqlite:///absolute/path, sqlite:relative/path and
+// sqlite::memory:, the URL forms optionally followed by ?pragma=name(value) (repeatable), which
+// is run on every new connection. path is empty for an in-memory database.
+func parseDSN(raw string) (path, dsn string, err error) {
+	if raw == "" {
+		return "", "", errors.New("database URL is empty")
+	}
+	if !strings.HasPrefix(raw, "sqlite:") {
+		return raw, "file:" + raw, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed database URL: %w", err)
+	}
+	if u.Host != "" {
+		return "", "", fmt.Errorf("database URL must not name a host %q; use sqlite:///absolute/path or sqlite:relative/path", u.Host)
+	}
+	path = u.Path
+	if u.Opaque != "" {
+		path = u.Opaque
+	}
+	if path == "" {
+		return "", "", errors.New("database URL has no path")
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed database URL query: %w", err)
+	}
+	params := url.Values{}
+	for key, values := range query {
+		if key != "pragma" {
+			return "", "", fmt.Errorf("unsupported database URL parameter %q", key)
+		}
+		for _, v := range values {
+			if v == "" {
+				return "", "", errors.New("database URL has an empty pragma")
+			}
+			params.Add("_pragma", v)
+		}
+	}
+
+	if path == ":memory:" {
+		path, dsn = "", memoryDSN
+	} else {
+		dsn = "file:" + path
+	}
+	if len(params) > 0 {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + params.Encode()
+	}
+	return path, dsn, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		raw, path, dsn, wantErr string
+	}{
+		{raw: "api.db", path: "api.db", dsn: "file:api.db"},
+		{raw: "sqlite:///var/lib/srest/api.db", path: "/var/lib/srest/api.db", dsn: "file:/var/lib/srest/api.db"},
+		{raw: "sqlite:data/api.db", path: "data/api.db", dsn: "file:data/api.db"},
+		{raw: "sqlite:///tmp/a.db?pragma=foreign_keys(1)", path: "/tmp/a.db", dsn: "file:/tmp/a.db?_pragma=foreign_keys%281%29"},
+		{raw: "sqlite::memory:", path: "", dsn: memoryDSN},
+		{raw: "sqlite::memory:?pragma=foreign_keys(1)", path: "", dsn: memoryDSN + "&_pragma=foreign_keys%281%29"},
+		{raw: "", wantErr: "empty"},
+		{raw: "sqlite://host/api.db", wantErr: "must not name a host"},
+		{raw: "sqlite:", wantErr: "no path"},
+		{raw: "sqlite:///tmp/a.db?mode=ro", wantErr: `unsupported database URL parameter "mode"`},
+		{raw: "sqlite:///tmp/a.db?pragma=", wantErr: "empty pragma"},
+		{raw: "sqlite:///tmp/a.db?pragma=%zz", wantErr: "malformed"},
+	}
+	for _, tt := range tests {
+		path, dsn, err := parseDSN(tt.raw)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseDSN(%q) error %v, want %q", tt.raw, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || path != tt.path || dsn != tt.dsn {
+			t.Errorf("parseDSN(%q) = %q, %q, %v, want %q, %q", tt.raw, path, dsn, err, tt.path, tt.dsn)
+		}
+	}
+}
+
+func TestDatabaseURLs(t *testing.T) {
+	for _, url := range []string{"sqlite:" + filepath.Join(t.TempDir(), "url.db"), "sqlite::memory:"} {
+		h := setupTest(t, func(c *Config) { c.DatabaseURL = url })
+		createItems(t, h, "apple")
+		if w := serve(h, "GET", "/items/1", ""); w.Code != http.StatusOK {
+			t.Errorf("%s: status %d", url, w.Code)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// itemETag is a strong validator for the current version of item. updated_at changes on every
+// write, so together with the id and name it identifies the representation.
+func itemETag(item Item) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(item.ID) + "\x00" + item.Name + "\x00" + item.UpdatedAt))
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether the If-Match or If-None-Match header value lists etag or is "*".
+// With weak set, W/ prefixes are ignored as If-None-Match requires; If-Match compares strongly.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces an If-Match precondition on item id inside tx, answering 412 when the
+// item has changed since the client read it, or no longer exists. The transaction holds the write
+// lock, so the item cannot change between this check and the caller's write. It returns false
+// once a response has been written.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, tx *sql.Tx, id int) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return true
+	}
+
+	var item Item
+	err := tx.QueryRowContext(r.Context(), "SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL", tenantFrom(r.Context()), id).Scan(item.fields()...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Item not found", http.StatusPreconditionFailed)
+		return false
+	}
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to retrieve item")
+		slog.ErrorContext(r.Context(), "Error querying item for If-Match", "err", err)
+		return false
+	}
+	if !etagMatches(ifMatch, itemETag(item), false) {
+		w.Header().Set("ETag", itemETag(item))
+		http.Error(w, "Item has changed since it was read", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIfNoneMatch(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple")
+
+	etag := serve(h, "GET", "/items/1", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("GET sent no ETag")
+	}
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w := serve(h, "GET", "/items/1", "", "If-None-Match", header)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: status %d, body %q, want 304 and no body", header, w.Code, w.Body)
+		}
+	}
+	if w := serve(h, "GET", "/items/1", "", "If-None-Match", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("non-matching If-None-Match: status %d, want 200", w.Code)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple")
+	stale := serve(h, "GET", "/items/1", "").Header().Get("ETag")
+
+	w := serve(h, "PUT", "/items/1", `{"name":"apricot"}`, "If-Match", stale)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT with the current ETag: status %d, body %q", w.Code, w.Body)
+	}
+	current := w.Header().Get("ETag")
+	if current == "" || current == stale {
+		t.Fatalf("PUT sent ETag %q, want a new one", current)
+	}
+
+	// Every write with the ETag read before the PUT is refused, and leaves the item as it was
+	for _, tt := range []struct{ method, body string }{
+		{"PUT", `{"name":"avocado"}`},
+		{"PATCH", `{"name":"avocado"}`},
+		{"DELETE", ""},
+	} {
+		w := serve(h, tt.method, "/items/1", tt.body, "If-Match", stale)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("%s with a stale ETag: status %d, want 412", tt.method, w.Code)
+		}
+		if got := w.Header().Get("ETag"); got != current {
+			t.Errorf("%s with a stale ETag: 412 ETag %q, want the current %q", tt.method, got, current)
+		}
+	}
+	if got := serve(h, "GET", "/items/1", "").Header().Get("ETag"); got != current {
+		t.Errorf("item changed after refused writes: ETag %q, want %q", got, current)
+	}
+
+	// A weak tag never satisfies If-Match, while the current strong one does
+	if w := serve(h, "DELETE", "/items/1", "", "If-Match", "W/"+current); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a weak ETag: status %d, want 412", w.Code)
+	}
+	if w := serve(h, "DELETE", "/items/1", "", "If-Match", current); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE with the current ETag: status %d, want 204", w.Code)
+	}
+	if w := serve(h, "PUT", "/items/1", `{"name":"avocado"}`, "If-Match", current); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT on a deleted item: status %d, want 412", w.Code)
+	}
+}
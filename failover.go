@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	primaryPath string                 // File path of the primary database, empty when in memory
+	primaryDSN  string                 // Driver DSN for the primary, as parsed by parseDSN
+	primaryDB   atomic.Pointer[sql.DB] // The read-write database opened by initDB
+	primaryFile os.FileInfo            // The primary file as it was when primaryDB was opened, guarded by reopenMu
+	reopenMu    sync.Mutex             // Serializes reopenPrimary between the two monitors
+	secondaryDB *sql.DB                // Optional read-only fallback, nil when failover is disabled
+	failedOver  atomic.Bool            // True while db points at secondaryDB
+)
+
+// initSecondaryDB opens the read-only fallback database used when the primary becomes unavailable
+func initSecondaryDB(path string) {
+	var err error
+	secondaryDB, err = openDB("file:" + path + "?mode=ro")
+	if err != nil {
+		fatal("Failed to open secondary database", "err", err)
+	}
+	if err := probe(secondaryDB); err != nil {
+		fatal("Failed to connect to secondary database", "err", err)
+	}
+	slog.Info("Secondary database ready for failover", "path", path)
+}
+
+// probe checks that a database is reachable and its schema is readable
+func probe(d *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var n int
+	return d.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&n)
+}
+
+var errPrimaryReplaced = errors.New("database file was replaced since it was opened")
+
+// statPrimary returns the primary database file's identity on disk, or nil when it is in memory
+func statPrimary() (os.FileInfo, error) {
+	if primaryPath == "" {
+		return nil, nil
+	}
+	return os.Stat(primaryPath)
+}
+
+// probePrimary checks that the primary database file is still present, is the file primaryDB
+// opened, and is answering queries. Pooled connections keep a replaced file open, so they would
+// go on answering from it.
+func probePrimary() error {
+	current, err := statPrimary()
+	if err != nil {
+		return err
+	}
+	reopenMu.Lock()
+	opened := primaryFile
+	reopenMu.Unlock()
+	if current != nil && opened != nil && !os.SameFile(opened, current) {
+		return errPrimaryReplaced
+	}
+	return probe(primaryDB.Load())
+}
+
+// reopenPrimary replaces primaryDB with a fresh handle, since pooled connections
+// may still reference a file that was replaced while the primary was down. The
+// fresh handle is also made current; Close lets queries already running on the
+// old handle finish.
+func reopenPrimary() error {
+	reopenMu.Lock()
+	defer reopenMu.Unlock()
+
+	// Stat first: opening a missing file would create an empty database in its place
+	file, err := statPrimary()
+	if err != nil {
+		return err
+	}
+	fresh, err := openDB(primaryDSN)
+	if err != nil {
+		return err
+	}
+	if err := probe(fresh); err != nil {
+		fresh.Close()
+		return err
+	}
+	old := primaryDB.Swap(fresh)
+	primaryFile = file
+	dbHandle.Store(fresh)
+	old.Close()
+	return nil
+}
+
+// monitorPrimary periodically probes the primary database, switching db to the
+// secondary when the primary fails and back again once it recovers
+func monitorPrimary(stop <-chan struct{}) {
+	ticker := time.NewTicker(cfg.FailoverProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if !failedOver.Load() {
+			if err := probePrimary(); err != nil {
+				// Flag read-only before swapping so no write reaches the secondary
+				failedOver.Store(true)
+				dbHandle.Store(secondaryDB)
+				slog.Warn("Primary database unavailable, failing over to read-only secondary", "err", err)
+			}
+			continue
+		}
+		// The old handle may still hold a file that has since been replaced, so recovery is
+		// judged on a fresh one
+		if err := reopenPrimary(); err != nil {
+			slog.Debug("Primary database still unavailable", "err", err)
+			continue
+		}
+		failedOver.Store(false)
+		slog.Info("Primary database recovered, switching back from secondary")
+	}
+}
+
+// rejectIfReadOnly responds with 503 and returns true while serving from the read-only secondary
+func rejectIfReadOnly(w http.ResponseWriter) bool {
+	if !failedOver.Load() {
+		return false
+	}
+	setRetryAfter(w)
+	http.Error(w, "Database is in read-only failover mode", http.StatusServiceUnavailable)
+	return true
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForFailover waits until failedOver reports want
+func waitForFailover(t *testing.T, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for failedOver.Load() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("failedOver did not become %v", want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFailoverServesReadsFromSecondary(t *testing.T) {
+	h := setupTest(t)
+	serve(h, "POST", "/items", `{"name":"apple"}`)
+
+	secondary := filepath.Join(t.TempDir(), "secondary.db")
+	if _, err := getDB().Exec("VACUUM INTO ?", secondary); err != nil {
+		t.Fatal(err)
+	}
+	initSecondaryDB(secondary)
+	t.Cleanup(func() { secondaryDB.Close() })
+
+	cfg.FailoverProbeInterval = 10 * time.Millisecond
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		monitorPrimary(stop)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+
+	// Simulate the primary's storage going away
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(primaryPath + suffix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForFailover(t, true)
+
+	if w := serve(h, "GET", "/items/by-name?name=apple", ""); w.Code != http.StatusOK {
+		t.Errorf("read from secondary: status %d, body %q", w.Code, w.Body)
+	}
+	if w := serve(h, "POST", "/items", `{"name":"banana"}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("write while failed over: status %d, want 503", w.Code)
+	}
+
+	// Bring the primary back, in one rename so the monitor never sees a partial file, and
+	// expect it to switch back
+	restored := filepath.Join(t.TempDir(), "restored.db")
+	if _, err := secondaryDB.Exec("VACUUM INTO ?", restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(restored, primaryPath); err != nil {
+		t.Fatal(err)
+	}
+	waitForFailover(t, false)
+
+	if w := serve(h, "POST", "/items", `{"name":"banana"}`); w.Code != http.StatusCreated {
+		t.Errorf("write after recovery: status %d, body %q", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+)
+
+var errFDLimitUnsupported = errors.New("open file limit not supported on this platform")
+
+// fdsPerConn is what one pooled SQLite connection holds open in WAL mode: the database, its
+// -wal and its -shm file
+const fdsPerConn = 3
+
+// checkOpenFileLimit warns at startup when the open file soft limit leaves less than FD_HEADROOM
+// descriptors for sockets and everything else once DB_MAX_OPEN_CONNS connections are open.
+// The Go runtime already raises the soft limit to the hard limit on start, so a low value here
+// means the hard limit itself needs raising (ulimit -Hn, LimitNOFILE= in systemd). limit reads
+// the soft limit; main passes openFileLimit, and a fake can stand in for it.
+func checkOpenFileLimit(limit func() (uint64, error)) {
+	soft, err := limit()
+	if errors.Is(err, errFDLimitUnsupported) {
+		return
+	}
+	if err != nil {
+		slog.Warn("Could not read the open file limit", "err", err)
+		return
+	}
+
+	needed := uint64(cfg.DBMaxOpenConns*fdsPerConn + cfg.FDHeadroom)
+	if soft < needed {
+		slog.Warn("Open file limit is low for the configured connection pool",
+			"limit", soft, "needed", needed, "db_max_open_conns", cfg.DBMaxOpenConns, "fd_headroom", cfg.FDHeadroom)
+	}
+}
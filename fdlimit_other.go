@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+// openFileLimit is not implemented on this platform, so the startup check is skipped
+func openFileLimit() (uint64, error) {
+	return 0, errFDLimitUnsupported
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckOpenFileLimit(t *testing.T) {
+	const (
+		lowMsg     = "Open file limit is low for the configured connection pool"
+		unreadable = "Could not read the open file limit"
+	)
+	cfg = envConfig()
+	cfg.DBMaxOpenConns, cfg.FDHeadroom = 10, 64
+	needed := uint64(10*fdsPerConn + 64)
+
+	tests := []struct {
+		name  string
+		limit uint64
+		err   error
+		warn  string
+	}{
+		{"plenty", 1 << 20, nil, ""},
+		{"exactly enough", needed, nil, ""},
+		{"one short", needed - 1, nil, lowMsg},
+		{"low", 32, nil, lowMsg},
+		{"unreadable", 0, errors.New("getrlimit: operation not permitted"), unreadable},
+		{"unsupported", 0, errFDLimitUnsupported, ""},
+	}
+	for _, tt := range tests {
+		buf := captureLogs(t)
+		checkOpenFileLimit(func() (uint64, error) { return tt.limit, tt.err })
+
+		var warnings []string
+		for _, msg := range []string{lowMsg, unreadable} {
+			for _, line := range logLines(t, buf, msg) {
+				warnings = append(warnings, msg)
+				if msg == lowMsg && (line["limit"] != float64(tt.limit) || line["needed"] != float64(needed)) {
+					t.Errorf("%s: warning %v, want limit %d and needed %d", tt.name, line, tt.limit, needed)
+				}
+			}
+		}
+		switch {
+		case tt.warn == "" && len(warnings) != 0:
+			t.Errorf("%s: unexpected warnings %q", tt.name, warnings)
+		case tt.warn != "" && (len(warnings) != 1 || warnings[0] != tt.warn):
+			t.Errorf("%s: warnings %q, want %q", tt.name, warnings, tt.warn)
+		}
+	}
+}
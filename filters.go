@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+	sampleScale      = 1000000 // Resolution of ?random_sample= fractions
+)
+
+// likeEscaper escapes LIKE wildcards so user input is matched literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// itemFilter accumulates the WHERE conditions shared by the list and count queries
+type itemFilter struct {
+	conds []string
+	args  []any
+}
+
+// newItemFilter returns a filter matching the items of tenant
+func newItemFilter(tenant string) *itemFilter {
+	f := &itemFilter{}
+	f.add("tenant_id = ?", tenant)
+	return f
+}
+
+// add appends a parameterized condition to the filter
+func (f *itemFilter) add(cond string, args ...any) {
+	f.conds = append(f.conds, cond)
+	f.args = append(f.args, args...)
+}
+
+// where renders the conditions as a WHERE clause, or an empty string when there are none
+func (f *itemFilter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// parseItemFilter builds an itemFilter over tenant's items from the list endpoint's query parameters
+func parseItemFilter(tenant string, q url.Values) (*itemFilter, error) {
+	f := newItemFilter(tenant)
+
+	// Soft-deleted items are hidden unless ?include_deleted=true asks for everything
+	if v := q.Get("include_deleted"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, errors.New("include_deleted must be a boolean")
+		}
+		if !include {
+			f.add("deleted_at IS NULL")
+		}
+	} else {
+		f.add("deleted_at IS NULL")
+	}
+
+	minID, err := parseIDParam(q, "min_id")
+	if err != nil {
+		return nil, err
+	}
+	maxID, err := parseIDParam(q, "max_id")
+	if err != nil {
+		return nil, err
+	}
+	if minID > 0 && maxID > 0 && minID > maxID {
+		return nil, errors.New("min_id must not be greater than max_id")
+	}
+	if minID > 0 {
+		f.add("id >= ?", minID)
+	}
+	if maxID > 0 {
+		f.add("id <= ?", maxID)
+	}
+
+	// Prefix match only, so "ca" finds "cafe" but not "pecan"
+	if prefix := q.Get("name_prefix"); prefix != "" {
+		f.add(`name LIKE ? ESCAPE '\'`, likeEscaper.Replace(prefix)+"%")
+	}
+
+	// Substring match anywhere in the name
+	if name := q.Get("name"); name != "" {
+		f.add(`name LIKE ? ESCAPE '\'`, "%"+likeEscaper.Replace(name)+"%")
+	}
+
+	// Calendar filters use the configured time zone; created_at is stored as RFC3339 UTC text, so
+	// comparing against UTC bounds in the same format is a range check
+	start, end, err := parseCreatedRange(q, time.Now().In(cfg.Timezone))
+	if err != nil {
+		return nil, err
+	}
+	if !start.IsZero() {
+		f.add("created_at >= ? AND created_at < ?", start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+	}
+
+	// Each row is kept independently with the given probability, so the result size is only
+	// approximately fraction*N and varies between requests; paging through a sample is not stable
+	if v := q.Get("random_sample"); v != "" {
+		fraction, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(fraction > 0 && fraction <= 1) {
+			return nil, errors.New("random_sample must be a number greater than 0 and at most 1")
+		}
+		if fraction < 1 {
+			f.add("abs(random() % ?) < ?", sampleScale, int(fraction*sampleScale))
+		}
+	}
+
+	return f, nil
+}
+
+// parseCreatedRange turns ?created_today=true or ?created_this_week=true (weeks start on Monday)
+// into the half-open interval containing now. Both zero means no calendar filter was requested.
+func parseCreatedRange(q url.Values, now time.Time) (start, end time.Time, err error) {
+	var today, week bool
+	for key, dst := range map[string]*bool{"created_today": &today, "created_this_week": &week} {
+		if v := q.Get(key); v != "" {
+			if *dst, err = strconv.ParseBool(v); err != nil {
+				return start, end, errors.New(key + " must be a boolean")
+			}
+		}
+	}
+	if today && week {
+		return start, end, errors.New("created_today and created_this_week are mutually exclusive")
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch {
+	case today:
+		return midnight, midnight.AddDate(0, 0, 1), nil
+	case week:
+		start = midnight.AddDate(0, 0, -(int(now.Weekday())+6)%7)
+		return start, start.AddDate(0, 0, 7), nil
+	}
+	return start, end, nil
+}
+
+// parseSort reads ?sort=field, or ?sort=-field for descending order, and returns the ORDER BY
+// clause. Fields are restricted to the searchFields allowlist; def is returned when sort is absent.
+func parseSort(q url.Values, def string) (string, error) {
+	v := q.Get("sort")
+	if v == "" {
+		return def, nil
+	}
+	dir := " ASC"
+	if strings.HasPrefix(v, "-") {
+		v, dir = v[1:], " DESC"
+	}
+	f, ok := searchFields[v]
+	if !ok {
+		return "", fmt.Errorf("unknown sort field %q", v)
+	}
+	return " ORDER BY " + f.column + dir, nil
+}
+
+// parseIDParam parses an optional positive integer id parameter, returning 0 when it is absent
+func parseIDParam(q url.Values, key string) (int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, errors.New(key + " must be a positive integer")
+	}
+	return n, nil
+}
+
+// parsePage reads ?limit= and ?offset=, applying defaultLimit when limit is absent
+func parsePage(q url.Values, defaultLimit int) (limit, offset int, err error) {
+	limit = defaultLimit
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+// itemIDs lists the ids in a GET /items response
+func itemIDs(t *testing.T, body []byte) []int {
+	t.Helper()
+	var items []Item
+	if err := json.Unmarshal(body, &items); err != nil {
+		t.Fatalf("decoding %q: %v", body, err)
+	}
+	ids := []int{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestIDRange(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "a", "b", "c", "d", "e")
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"min_id=3", []int{3, 4, 5}},
+		{"max_id=2", []int{1, 2}},
+		{"min_id=2&max_id=4", []int{2, 3, 4}},
+		{"min_id=3&max_id=3", []int{3}},
+		{"min_id=2&max_id=5&sort=-id&limit=2", []int{5, 4}},
+		{"min_id=2&max_id=5&limit=2&offset=2", []int{4, 5}},
+	}
+	for _, tt := range tests {
+		w := serve(h, "GET", "/items?"+tt.query, "")
+		if got := itemIDs(t, w.Body.Bytes()); !slices.Equal(got, tt.want) {
+			t.Errorf("?%s: ids %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"min_id=4&max_id=2", "min_id=x", "max_id=-1", "min_id=0"} {
+		if w := serve(h, "GET", "/items?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestNamePrefix(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.AutocompleteLimit = 2 })
+	createItems(t, h, "cashew", "pecan", "carrot", "cabbage", "50%_off")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"name_prefix=ca", []string{"cabbage", "carrot"}},
+		{"name_prefix=ca&limit=5", []string{"cabbage", "carrot", "cashew"}},
+		{"name_prefix=can", nil},
+		{"name_prefix=50%25_", []string{"50%_off"}},
+		{"name_prefix=5_%25", nil},
+		{"name=ca&limit=5", []string{"cashew", "pecan", "carrot", "cabbage"}},
+	}
+	for _, tt := range tests {
+		w := serve(h, "GET", "/items?"+tt.query, "")
+		if got := itemNames(t, w.Body.Bytes()); !slices.Equal(got, tt.want) {
+			t.Errorf("?%s: %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRandomSample(t *testing.T) {
+	h := setupTest(t)
+	tx, err := getDB().Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2000 {
+		name := fmt.Sprintf("item-%d", i)
+		if _, err := tx.Exec("INSERT INTO items (name, name_key) VALUES (?, ?)", name, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(query string) int {
+		t.Helper()
+		var got struct{ Count int }
+		w := serve(h, "GET", "/items?count_only=true&"+query, "")
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("?%s: status %d, body %q", query, w.Code, w.Body)
+		}
+		return got.Count
+	}
+
+	// The expected 500 has a standard deviation near 20, so the bounds are about five of them
+	if n := count("random_sample=0.25"); n < 400 || n > 600 {
+		t.Errorf("random_sample=0.25 kept %d of 2000, want about 500", n)
+	}
+	// Combined with a filter matching 1000 items
+	if n := count("random_sample=0.5&max_id=1000"); n < 400 || n > 600 {
+		t.Errorf("random_sample=0.5 with max_id=1000 kept %d, want about 500", n)
+	}
+	if n := count("random_sample=1"); n != 2000 {
+		t.Errorf("random_sample=1 kept %d, want all 2000", n)
+	}
+
+	for _, v := range []string{"0", "-0.1", "1.5", "x", "NaN"} {
+		if w := serve(h, "GET", "/items?random_sample="+v, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("random_sample=%s: status %d, want 400", v, w.Code)
+		}
+	}
+}
+
+func TestCreatedToday(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "today", "yesterday", "last week", "tomorrow")
+	now := time.Now().UTC()
+	for name, created := range map[string]time.Time{
+		"yesterday": now.AddDate(0, 0, -1),
+		"last week": now.AddDate(0, 0, -8),
+		"tomorrow":  now.AddDate(0, 0, 1),
+	} {
+		getDB().Exec("UPDATE items SET created_at = ? WHERE name = ?", created.Format(time.RFC3339), name)
+	}
+
+	w := serve(h, "GET", "/items?created_today=true", "")
+	if got := itemNames(t, w.Body.Bytes()); !slices.Equal(got, []string{"today"}) {
+		t.Errorf("created_today: %q, want [today]", got)
+	}
+	w = serve(h, "GET", "/items?created_today=true&name=yes", "")
+	if got := itemNames(t, w.Body.Bytes()); len(got) != 0 {
+		t.Errorf("created_today with name=yes: %q, want none", got)
+	}
+	w = serve(h, "GET", "/items?created_this_week=true", "")
+	if got := itemNames(t, w.Body.Bytes()); slices.Contains(got, "last week") || !slices.Contains(got, "today") {
+		t.Errorf("created_this_week: %q", got)
+	}
+
+	for _, query := range []string{"created_today=true&created_this_week=true", "created_today=yes"} {
+		if w := serve(h, "GET", "/items?"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestParseCreatedRange(t *testing.T) {
+	tz := time.FixedZone("UTC+10", 10*60*60)
+	// Wednesday 2024-05-15 01:30 in UTC+10 is still Tuesday in UTC
+	now := time.Date(2024, 5, 15, 1, 30, 0, 0, tz)
+
+	tests := []struct {
+		query      string
+		start, end time.Time
+	}{
+		{"created_today=true", time.Date(2024, 5, 15, 0, 0, 0, 0, tz), time.Date(2024, 5, 16, 0, 0, 0, 0, tz)},
+		{"created_this_week=true", time.Date(2024, 5, 13, 0, 0, 0, 0, tz), time.Date(2024, 5, 20, 0, 0, 0, 0, tz)},
+		{"created_today=false", time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		start, end, err := parseCreatedRange(q, now)
+		if err != nil || !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("?%s: [%v, %v) %v, want [%v, %v)", tt.query, start, end, err, tt.start, tt.end)
+		}
+	}
+
+	// A Sunday belongs to the week that started the previous Monday
+	sunday := time.Date(2024, 5, 19, 23, 0, 0, 0, tz)
+	q, _ := url.ParseQuery("created_this_week=true")
+	if start, _, _ := parseCreatedRange(q, sunday); !start.Equal(time.Date(2024, 5, 13, 0, 0, 0, 0, tz)) {
+		t.Errorf("week of a Sunday starts %v, want Monday 2024-05-13", start)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query         string
+		limit, offset int
+		ok            bool
+	}{
+		{"", 50, 0, true},
+		{"limit=1&offset=3", 1, 3, true},
+		{fmt.Sprintf("limit=%d", maxPageLimit), maxPageLimit, 0, true},
+		{"limit=0", 0, 0, false},
+		{"limit=-1", 0, 0, false},
+		{fmt.Sprintf("limit=%d", maxPageLimit+1), 0, 0, false},
+		{"limit=ten", 0, 0, false},
+		{"offset=-1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		limit, offset, err := parsePage(q, 50)
+		if (err == nil) != tt.ok || limit != tt.limit || offset != tt.offset {
+			t.Errorf("?%s: limit %d, offset %d, err %v", tt.query, limit, offset, err)
+		}
+	}
+
+	h := setupTest(t)
+	if w := serve(h, "GET", "/items?limit=0", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("?limit=0: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+const serviceName = "simplerest"
+
+// version is overridden at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+var errDiskUsageUnsupported = errors.New("disk usage not supported on this platform")
+
+// diskFree is a variable so the threshold logic can be exercised without filling a disk
+var diskFree = diskFreeBytes
+
+// rootHandler answers GET and HEAD on / with basic service info, without touching the database
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"name": serviceName, "version": version})
+}
+
+// healthzHandler is a cheap probe for load balancers: it pings the database without touching
+// the items table. /readyz additionally checks free disk space before accepting writes.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	status, body := http.StatusOK, "ok"
+	if err := getDB().PingContext(r.Context()); err != nil {
+		slog.WarnContext(r.Context(), "Health database ping failed", "err", err)
+		status, body = http.StatusServiceUnavailable, "unavailable"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"status": body})
+}
+
+// readiness is the body returned by /readyz
+type readiness struct {
+	Status        string  `json:"status"`
+	Database      string  `json:"database"`
+	DiskFreeBytes *uint64 `json:"disk_free_bytes,omitempty"`
+	DiskMinFree   uint64  `json:"disk_min_free_bytes"`
+}
+
+// readyzHandler reports whether the database is reachable and has enough free disk for writes
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	body := readiness{Status: "ok", Database: "ok", DiskMinFree: cfg.MinFreeDiskBytes}
+
+	err := getDB().PingContext(r.Context())
+	if err != nil {
+		slog.WarnContext(r.Context(), "Readiness database ping failed", "err", err)
+		body.Database = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	var free uint64
+	err = errDiskUsageUnsupported // An in-memory database has no filesystem to check
+	if primaryPath != "" {
+		free, err = diskFree(primaryPath)
+	}
+	switch {
+	case errors.Is(err, errDiskUsageUnsupported):
+		// Degrade gracefully: readiness depends on the database alone
+	case err != nil:
+		slog.WarnContext(r.Context(), "Readiness disk check failed", "err", err)
+		status = http.StatusServiceUnavailable
+	default:
+		body.DiskFreeBytes = &free
+		if free < cfg.MinFreeDiskBytes {
+			slog.WarnContext(r.Context(), "Free disk space is below threshold", "free_bytes", free, "min_free_bytes", cfg.MinFreeDiskBytes)
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	if status != http.StatusOK {
+		body.Status = "unavailable"
+		setRetryAfter(w)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
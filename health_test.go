@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// stubDiskFree makes diskFree report free bytes, or fail with err, until the test ends
+func stubDiskFree(t *testing.T, free uint64, err error) {
+	t.Helper()
+	saved := diskFree
+	diskFree = func(string) (uint64, error) { return free, err }
+	t.Cleanup(func() { diskFree = saved })
+}
+
+func TestReadyzDiskThreshold(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.MinFreeDiskBytes = 100 << 20 })
+
+	tests := []struct {
+		name string
+		free uint64
+		err  error
+		want int
+	}{
+		{"above threshold", 200 << 20, nil, http.StatusOK},
+		{"at threshold", 100 << 20, nil, http.StatusOK},
+		{"below threshold", 100<<20 - 1, nil, http.StatusServiceUnavailable},
+		{"check failed", 0, errors.New("statfs: input/output error"), http.StatusServiceUnavailable},
+		{"unsupported", 0, errDiskUsageUnsupported, http.StatusOK},
+	}
+	for _, tt := range tests {
+		stubDiskFree(t, tt.free, tt.err)
+		w := serve(h, "GET", "/readyz", "")
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d, body %q", tt.name, w.Code, tt.want, w.Body)
+		}
+		var body readiness
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if (tt.want == http.StatusOK) != (body.Status == "ok") {
+			t.Errorf("%s: status field %q with code %d", tt.name, body.Status, w.Code)
+		}
+		if tt.err == nil && (body.DiskFreeBytes == nil || *body.DiskFreeBytes != tt.free) {
+			t.Errorf("%s: disk_free_bytes %v, want %d", tt.name, body.DiskFreeBytes, tt.free)
+		}
+		if tt.want != http.StatusOK && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: no Retry-After on 503", tt.name)
+		}
+	}
+}
+
+func TestRoot(t *testing.T) {
+	h := setupTest(t)
+	// The root answers without the database
+	primaryDB.Load().Close()
+
+	w := serve(h, "GET", "/", "")
+	var info map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET: status %d, body %q", w.Code, w.Body)
+	}
+	if info["name"] != serviceName || info["version"] != version {
+		t.Errorf("GET: %v", info)
+	}
+
+	w = serve(h, "HEAD", "/", "")
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("HEAD: status %d, body %q, want 200 and no body", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("HEAD: Content-Type %q", ct)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errBlockedAddress = errors.New("destination address is not allowed")
+
+// importClient fetches remote import sources. Its dialer checks every resolved address,
+// including those reached through redirects, so DNS tricks can't reach internal hosts.
+var importClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil, // A proxy would hide the destination address from the dial check
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || (!cfg.ImportAllowPrivate && isBlockedIP(ip)) {
+					return fmt.Errorf("%w: %s", errBlockedAddress, host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		return checkImportScheme(req.URL)
+	},
+}
+
+// blockedPrefixes are the address ranges imports may not reach: everything IANA marks as not
+// globally reachable, plus translation prefixes that lead back into those ranges
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("10.0.0.0/8"),      // Private
+	netip.MustParsePrefix("100.64.0.0/10"),   // Shared address space (carrier-grade NAT)
+	netip.MustParsePrefix("127.0.0.0/8"),     // Loopback
+	netip.MustParsePrefix("169.254.0.0/16"),  // Link-local, including cloud metadata services
+	netip.MustParsePrefix("172.16.0.0/12"),   // Private
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation (TEST-NET-1)
+	netip.MustParsePrefix("192.168.0.0/16"),  // Private
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation (TEST-NET-3)
+	netip.MustParsePrefix("224.0.0.0/4"),     // Multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, including broadcast
+	netip.MustParsePrefix("::/128"),          // Unspecified
+	netip.MustParsePrefix("::1/128"),         // Loopback
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which maps onto any IPv4 address
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, including Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, which embeds an IPv4 address
+	netip.MustParsePrefix("fc00::/7"),        // Unique local
+	netip.MustParsePrefix("fe80::/10"),       // Link-local
+	netip.MustParsePrefix("ff00::/8"),        // Multicast
+}
+
+// isBlockedIP reports whether ip falls in one of blockedPrefixes. IPv4-mapped IPv6 addresses
+// are checked as the IPv4 address they carry.
+func isBlockedIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImportScheme allows only plain http and https sources
+func checkImportScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// importRowError reports a row that could not be imported; Row is 1-based in source order
+type importRowError struct {
+	Row   int    `json:"row"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// importSummary reports the outcome of an import for each row
+type importSummary struct {
+	Inserted  int              `json:"inserted"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Skipped   int              `json:"skipped"`
+	Errors    []importRowError `json:"errors,omitempty"`
+}
+
+// importURLHandler fetches a remote JSON array or CSV file of items and inserts it by name.
+// on_conflict chooses what happens to a row whose name already exists: "skip" (the default)
+// leaves the stored item alone, "update" restores it if it was soft-deleted and leaves a live one
+// unwritten, and "fail" rolls back the whole import.
+func importURLHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	var req struct {
+		URL        string `json:"url"`
+		OnConflict string `json:"on_conflict"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	switch req.OnConflict {
+	case "":
+		req.OnConflict = "skip"
+	case "skip", "update", "fail":
+	default:
+		http.Error(w, `Invalid on_conflict: must be "skip", "update" or "fail"`, http.StatusBadRequest)
+		return
+	}
+	src, err := url.Parse(req.URL)
+	if err != nil || src.Host == "" {
+		http.Error(w, "Invalid import URL", http.StatusBadRequest)
+		return
+	}
+	if err := checkImportScheme(src); err != nil {
+		http.Error(w, "Invalid import URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The fetch has its own IMPORT_TIMEOUT, which may exceed the request timeout, so it runs
+	// detached from the request deadline and the upsert that follows gets a fresh one
+	ctx := context.WithoutCancel(r.Context())
+	items, err := fetchImport(ctx, src)
+	if errors.Is(err, errBlockedAddress) {
+		http.Error(w, "Import URL resolves to a blocked address", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch import: "+err.Error(), http.StatusBadGateway)
+		slog.ErrorContext(r.Context(), "Error fetching import", "url", src.Redacted(), "err", err)
+		return
+	}
+	if rejectIfBatchTooLarge(w, len(items)) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+	defer cancel()
+	writeImport(ctx, w, items, req.OnConflict)
+}
+
+// importStatements holds the insert used for each on_conflict mode. "skip" covers the
+// canonical name_key index too, so a case or accent variant of a stored name is skipped. "update"
+// only writes a soft-deleted row, so a live one keeps its updated_at and its ETag.
+var importStatements = map[string]string{
+	"skip":   "INSERT INTO items (tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING",
+	"update": "INSERT INTO items (tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?) ON CONFLICT(tenant_id, name) DO UPDATE SET updated_at = excluded.updated_at, deleted_at = NULL WHERE items.deleted_at IS NOT NULL",
+	"fail":   "INSERT INTO items (tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+}
+
+// writeImport inserts items in one transaction according to onConflict and writes the summary.
+// Invalid names, and name conflicts that the mode does not resolve, are reported per row, except
+// that in "fail" mode the first conflict rolls the import back with a 409.
+func writeImport(ctx context.Context, w http.ResponseWriter, items []Item, onConflict string) {
+	tx, err := getDB().BeginTx(ctx, nil)
+	if err != nil {
+		writeDBError(ctx, w, err, "Failed to import items")
+		slog.ErrorContext(ctx, "Error beginning import transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	now, tenant := timestamp(), tenantFrom(ctx)
+	var summary importSummary
+	for i, item := range items {
+		if err := validateItem(&item); err != nil {
+			summary.Errors = append(summary.Errors, importRowError{Row: i + 1, Name: item.Name, Error: err.Error()})
+			continue
+		}
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM items WHERE tenant_id = ? AND name = ?)", tenant, item.Name).Scan(&exists); err != nil {
+			writeDBError(ctx, w, err, "Failed to import items")
+			slog.ErrorContext(ctx, "Error checking item existence", "err", err)
+			return
+		}
+		res, err := tx.ExecContext(ctx, importStatements[onConflict], tenant, item.Name, nameKey(item.Name), now, now)
+		if isNameConflict(err) {
+			if onConflict == "fail" {
+				writeJSONError(w, http.StatusConflict, fmt.Sprintf("row %d: item name already exists: %q", i+1, item.Name))
+				return
+			}
+			summary.Errors = append(summary.Errors, importRowError{Row: i + 1, Name: item.Name, Error: "item name already exists"})
+			continue
+		}
+		if err != nil {
+			writeDBError(ctx, w, err, "Failed to import items")
+			slog.ErrorContext(ctx, "Error importing item", "err", err)
+			return
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			writeDBError(ctx, w, err, "Failed to get rows affected")
+			slog.ErrorContext(ctx, "Error getting rows affected", "err", err)
+			return
+		}
+		switch {
+		case n == 0 && onConflict == "update":
+			summary.Unchanged++
+		case n == 0:
+			summary.Skipped++
+		case exists:
+			summary.Updated++
+		default:
+			summary.Inserted++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(ctx, w, err, "Failed to import items")
+		slog.ErrorContext(ctx, "Error committing import", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// fetchImport downloads src within the configured timeout and size cap and parses it as JSON or CSV
+func fetchImport(ctx context.Context, src *url.URL) ([]Item, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.ImportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, text/csv")
+	if t, ok := traceFrom(ctx); ok {
+		req.Header.Set("traceparent", t.traceparent())
+	}
+	resp, err := importClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("source returned %s", resp.Status)
+	}
+
+	// Read one byte past the cap so an oversized source is detected rather than truncated
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cfg.ImportMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > cfg.ImportMaxBytes {
+		return nil, fmt.Errorf("source exceeds %d bytes", cfg.ImportMaxBytes)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/csv" || strings.HasSuffix(src.Path, ".csv") {
+		return parseCSVItems(body)
+	}
+	if err := checkJSONComplexity(body); err != nil {
+		return nil, err
+	}
+	var items []Item
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return items, nil
+}
+
+// parseCSVItems reads items from CSV with a header row containing a name column
+func parseCSVItems(body []byte) ([]Item, error) {
+	records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	col := -1
+	for i, h := range records[0] {
+		if strings.EqualFold(strings.TrimSpace(h), "name") {
+			col = i
+			break
+		}
+	}
+	if col < 0 {
+		return nil, errors.New("CSV header has no name column")
+	}
+
+	items := make([]Item, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		items = append(items, Item{Name: rec[col]})
+	}
+	return items, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsBlockedIP(t *testing.T) {
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"0.1.2.3", true},
+		{"192.0.0.170", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"255.255.255.255", true},
+		{"::1", true},
+		{"::", true},
+		{"::ffff:127.0.0.1", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"93.184.215.14", false},
+		{"100.128.0.1", false},
+		{"198.20.0.1", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		if got := isBlockedIP(net.ParseIP(tt.ip)); got != tt.blocked {
+			t.Errorf("isBlockedIP(%s) = %v, want %v", tt.ip, got, tt.blocked)
+		}
+	}
+}
+
+func TestImportURL(t *testing.T) {
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("id,name\n1,apple\n2,banana\n3,\n"))
+	}))
+	defer src.Close()
+	body := `{"url":"` + src.URL + `/items.csv"}`
+
+	// The source listens on loopback, which is blocked unless private addresses are allowed
+	h := setupTest(t)
+	if w := serve(h, "POST", "/items/import-url", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("loopback source: status %d, want 400", w.Code)
+	}
+	if w := serve(h, "POST", "/items/import-url", `{"url":"file:///etc/passwd"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("file URL: status %d, want 400", w.Code)
+	}
+
+	cfg.ImportAllowPrivate = true
+	w := serve(h, "POST", "/items/import-url", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("allowed source: status %d, body %q", w.Code, w.Body)
+	}
+	var summary importSummary
+	if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Inserted != 2 || len(summary.Errors) != 1 || summary.Errors[0].Row != 3 {
+		t.Errorf("summary %+v, want 2 inserted and row 3 rejected", summary)
+	}
+}
+
+func TestImportURLOnConflict(t *testing.T) {
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"name":"kiwi"},{"name":"apple"},{"name":"banana"}]`))
+	}))
+	defer src.Close()
+
+	tests := []struct {
+		mode    string
+		want    int
+		summary importSummary
+	}{
+		{"", http.StatusOK, importSummary{Inserted: 1, Skipped: 2}},
+		{"skip", http.StatusOK, importSummary{Inserted: 1, Skipped: 2}},
+		{"update", http.StatusOK, importSummary{Inserted: 1, Updated: 1, Unchanged: 1}},
+		{"fail", http.StatusConflict, importSummary{}},
+	}
+	for _, tt := range tests {
+		// apple is live and banana soft-deleted before the import
+		h := setupTest(t, func(c *Config) { c.ImportAllowPrivate = true })
+		createItems(t, h, "apple", "banana")
+		serve(h, "DELETE", "/items/2", "")
+		getDB().Exec("UPDATE items SET updated_at = '2000-01-01T00:00:00Z'")
+		etag := serve(h, "GET", "/items/1", "").Header().Get("ETag")
+
+		w := serve(h, "POST", "/items/import-url", `{"url":"`+src.URL+`","on_conflict":"`+tt.mode+`"}`)
+		if w.Code != tt.want {
+			t.Errorf("on_conflict %q: status %d, want %d, body %q", tt.mode, w.Code, tt.want, w.Body)
+			continue
+		}
+		if tt.want != http.StatusOK {
+			if w := serve(h, "GET", "/items/count", ""); w.Body.String() != `{"count":1}`+"\n" {
+				t.Errorf("on_conflict fail left rows behind: count %q", w.Body)
+			}
+			continue
+		}
+		var got importSummary
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if got.Inserted != tt.summary.Inserted || got.Updated != tt.summary.Updated || got.Unchanged != tt.summary.Unchanged ||
+			got.Skipped != tt.summary.Skipped || len(got.Errors) != 0 {
+			t.Errorf("on_conflict %q: summary %+v, want %+v", tt.mode, got, tt.summary)
+		}
+
+		// No mode rewrites the live apple, so clients holding its ETag can still write it
+		w = serve(h, "GET", "/items/1", "")
+		var apple Item
+		json.Unmarshal(w.Body.Bytes(), &apple)
+		if apple.UpdatedAt != "2000-01-01T00:00:00Z" || w.Header().Get("ETag") != etag {
+			t.Errorf("on_conflict %q rewrote the live item: updated_at %s, ETag %q, want %q", tt.mode, apple.UpdatedAt, w.Header().Get("ETag"), etag)
+		}
+	}
+
+	h := setupTest(t, func(c *Config) { c.ImportAllowPrivate = true })
+	if w := serve(h, "POST", "/items/import-url", `{"url":"`+src.URL+`","on_conflict":"merge"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown on_conflict: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// initLogger makes a JSON slog handler at cfg.LogLevel the default logger. Calls through the
+// standard log package are routed to it as well.
+func initLogger() {
+	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+// contextHandler adds the trace_id of the request being served to every record logged with its
+// context, e.g. through slog.ErrorContext(r.Context(), ...), so a handler's own log lines can be
+// joined with the request line. The first error logged this way is also noted for the request line.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if t, ok := traceFrom(ctx); ok {
+		r.AddAttrs(slog.String("trace_id", t.TraceID))
+	}
+	if entry, ok := ctx.Value(requestLogKey{}).(*requestLog); ok && r.Level >= slog.LevelError {
+		entry.noteError(r)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// fatal logs msg at error level with the given attributes and exits, replacing log.Fatalf
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// statusRecorder captures the status code a handler writes so it can be logged
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// requestLog carries what handlers report about a request to its request line
+type requestLog struct {
+	err atomic.Pointer[string] // The first error logged while serving the request
+}
+
+type requestLogKey struct{}
+
+// noteError keeps the "err" attribute of r, or its message if it has none, unless an error was
+// already noted
+func (l *requestLog) noteError(r slog.Record) {
+	msg := r.Message
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "err" {
+			msg = a.Value.String()
+			return false
+		}
+		return true
+	})
+	l.err.CompareAndSwap(nil, &msg)
+}
+
+// logRequests logs one structured line per request with its method, path, status and duration.
+// Server errors are logged at error level, everything else at info. Handlers log the cause with
+// the request context, and the first error they log is repeated in the request line.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &requestLog{}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey{}, entry))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err := entry.err.Load(); err != nil {
+			attrs = append(attrs, "err", *err)
+		}
+		// contextHandler adds the trace_id
+		slog.Log(r.Context(), level, "Request", attrs...)
+	})
+}
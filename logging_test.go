@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequestLogLine(t *testing.T) {
+	h := setupTest(t)
+	logs := captureLogs(t)
+
+	serve(h, "GET", "/items", "")
+	lines := logLines(t, logs, "Request")
+	if len(lines) != 1 {
+		t.Fatalf("%d request lines, want 1", len(lines))
+	}
+	for _, key := range []string{"method", "path", "status", "duration_ms", "trace_id"} {
+		if _, ok := lines[0][key]; !ok {
+			t.Errorf("request line lacks %s: %v", key, lines[0])
+		}
+	}
+	if _, ok := lines[0]["err"]; ok {
+		t.Errorf("successful request logged an error: %v", lines[0])
+	}
+
+	logs.Reset()
+	getDB().Close()
+	if w := serve(h, "GET", "/items", ""); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d with the database closed, want 500", w.Code)
+	}
+	lines = logLines(t, logs, "Request")
+	if len(lines) != 1 || lines[0]["level"] != "ERROR" || lines[0]["err"] != "sql: database is closed" {
+		t.Errorf("request lines %v, want one at ERROR with the handler's err", lines)
+	}
+}
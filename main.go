@@ -1,142 +1,435 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
-	"sync" // For basic concurrency safety on the database connection
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	_ "modernc.org/sqlite" // Pure Go SQLite driver
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 // Item represents the structure of our data
 type Item struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID        int     `json:"id"`
+	Name      string  `json:"name"`
+	CreatedAt string  `json:"created_at"`           // RFC3339 UTC, set by the server on insert
+	UpdatedAt string  `json:"updated_at"`           // RFC3339 UTC, set by the server on every write
+	DeletedAt *string `json:"deleted_at,omitempty"` // RFC3339 UTC when soft-deleted, nil while live
 }
 
-var (
-	db   *sql.DB
-	dbMu sync.Mutex // Mutex to protect database operations
-)
+// itemColumns is the select list matching Item.fields
+const itemColumns = "id, name, created_at, updated_at, deleted_at"
+
+// fields returns scan destinations for a row selected with itemColumns
+func (it *Item) fields() []any {
+	return []any{&it.ID, &it.Name, &it.CreatedAt, &it.UpdatedAt, &it.DeletedAt}
+}
+
+// timestamp returns the current time in the format stored in created_at and updated_at
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// dbHandle holds the database requests run against. database/sql pools
+// connections, so the only shared state to guard is which handle is current,
+// which the failover and connection monitors swap atomically.
+var dbHandle atomic.Pointer[sql.DB]
+
+// getDB returns the database handle requests should use
+func getDB() *sql.DB {
+	return dbHandle.Load()
+}
 
-// initDB initializes the SQLite database and creates the 'items' table
+// openDB opens a pooled SQLite handle. Each connection waits up to 5s on a
+// locked database instead of failing with SQLITE_BUSY, and transactions take
+// the write lock up front (BEGIN IMMEDIATE) so they cannot deadlock upgrading
+// from a read lock.
+func openDB(dataSourceName string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(dataSourceName, "?") {
+		sep = "&"
+	}
+	d, err := sql.Open("sqlite", dataSourceName+sep+"_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	d.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	d.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	d.SetConnMaxIdleTime(cfg.DBConnMaxIdleTime)
+	if strings.Contains(dataSourceName, "mode=memory") {
+		// An in-memory database is dropped with its last connection, so hold exactly one open
+		d.SetMaxOpenConns(1)
+		d.SetMaxIdleConns(1)
+		d.SetConnMaxIdleTime(0)
+	}
+	return d, nil
+}
+
+// initDB initializes the SQLite database named by a path or sqlite: URL (see parseDSN)
+// and creates the 'items' table
 func initDB(dataSourceName string) {
 	var err error
-	// For modernc.org/sqlite, the DSN is typically just the file path
-	db, err = sql.Open("sqlite", dataSourceName) // Note: "sqlite" as driver name
+	primaryPath, primaryDSN, err = parseDSN(dataSourceName)
+	if err != nil {
+		fatal("Invalid database URL", "url", dataSourceName, "err", err)
+	}
+	db, err := openDB(primaryDSN)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		fatal("Failed to open database", "err", err)
 	}
 
 	// Ping the database to ensure the connection is established
 	err = db.Ping()
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", "err", err)
+	}
+	slog.Info("Connected to SQLite database", "url", dataSourceName)
+	if primaryFile, err = statPrimary(); err != nil {
+		fatal("Failed to stat database file", "err", err)
 	}
-	log.Printf("Connected to SQLite database: %s", dataSourceName)
 
-	// Create the 'items' table if it doesn't exist
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS items (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE
-	);`
+	// WAL lets readers proceed while a write is in progress. The mode is
+	// stored in the database file, so setting it once covers every connection.
+	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		fatal("Failed to enable WAL mode", "err", err)
+	}
+
+	dbHandle.Store(db)
+	if !cfg.ManageSchema {
+		if err := verifySchema(); err != nil {
+			fatal("Database schema does not match and MANAGE_SCHEMA is off", "err", err)
+		}
+		slog.Info("Verified externally managed schema")
+		return
+	}
 
-	dbMu.Lock()
-	_, err = db.Exec(createTableSQL)
-	dbMu.Unlock()
+	// Create the 'items' table if it doesn't exist
+	_, err = db.Exec(fmt.Sprintf(createItemsTable, "items"))
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		fatal("Failed to create table", "err", err)
 	}
-	log.Println("Table 'items' ensured to exist.")
+	slog.Info("Table 'items' ensured to exist")
+
+	migrateDB()
 }
 
-// getItemsHandler retrieves all items from the database
+// getItemsHandler retrieves a page of items (?limit=, ?offset=) from the database, or just their
+// count with ?count_only=true. Send X-Include-Count: true to get the unpaged total in X-Total-Count.
+// ?name= filters on a substring, ?created_today= and ?created_this_week= on the calendar in TIMEZONE,
+// ?sort=name or ?sort=-id orders the page, and
+// ?random_sample=0.1 keeps roughly that fraction of the matching rows. Accept: text/csv returns CSV,
+// with ?columns=name,id choosing its columns and their order.
 func getItemsHandler(w http.ResponseWriter, r *http.Request) {
-	dbMu.Lock()
-	rows, err := db.Query("SELECT id, name FROM items")
-	dbMu.Unlock()
+	filter, err := parseItemFilter(tenantFrom(r.Context()), r.URL.Query())
 	if err != nil {
-		http.Error(w, "Failed to retrieve items", http.StatusInternalServerError)
-		log.Printf("Error querying items: %v", err)
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if v := r.URL.Query().Get("count_only"); v != "" {
+		countOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid count_only value", http.StatusBadRequest)
+			return
+		}
+		if countOnly {
+			countItems(w, r, filter)
+			return
+		}
+	}
+
+	// The list queries get their own deadline, shorter than the request's, so one slow scan is
+	// cancelled and answered with a retryable 503 rather than holding a connection until a 504
+	ctx, cancel := context.WithTimeoutCause(r.Context(), cfg.ListQueryTimeout, errListQueryTimeout)
+	defer cancel()
+
+	// The total is opt-in because it costs an extra COUNT query
+	if includeCount, _ := strconv.ParseBool(r.Header.Get("X-Include-Count")); includeCount {
+		count, err := queryItemCount(ctx, filter)
+		if err != nil {
+			writeListError(ctx, w, err, "Failed to count items")
+			slog.ErrorContext(r.Context(), "Error counting items", "err", err)
+			return
+		}
+		w.Header().Set("X-Total-Count", strconv.Itoa(count))
+	}
+
+	// Autocomplete lookups are alphabetical and short; everything else pages in id order
+	orderBy, defaultLimit := " ORDER BY id", defaultPageLimit
+	if r.URL.Query().Get("name_prefix") != "" {
+		orderBy, defaultLimit = " ORDER BY name", cfg.AutocompleteLimit
+	}
+	orderBy, err = parseSort(r.URL.Query(), orderBy)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	columns, err := parseCSVColumns(r.URL.Query())
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := parsePage(r.URL.Query(), defaultLimit)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := "SELECT " + itemColumns + " FROM items" + filter.where() + orderBy + " LIMIT ? OFFSET ?"
+	args := append(filter.args, limit, offset)
+
+	rows, err := getDB().QueryContext(ctx, query, args...)
+	if err != nil {
+		writeListError(ctx, w, err, "Failed to retrieve items")
+		slog.ErrorContext(r.Context(), "Error querying items", "err", err)
 		return
 	}
 	defer rows.Close()
 
-	var items []Item
+	items := []Item{} // Non-nil so an empty table encodes as [] rather than null
 	for rows.Next() {
 		var item Item
-		if err := rows.Scan(&item.ID, &item.Name); err != nil {
-			http.Error(w, "Failed to scan item", http.StatusInternalServerError)
-			log.Printf("Error scanning item: %v", err)
+		if err := rows.Scan(item.fields()...); err != nil {
+			writeListError(ctx, w, err, "Failed to scan item")
+			slog.ErrorContext(r.Context(), "Error scanning item", "err", err)
 			return
 		}
 		items = append(items, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		http.Error(w, "Error iterating rows", http.StatusInternalServerError)
-		log.Printf("Error during row iteration: %v", err)
+		writeListError(ctx, w, err, "Error iterating rows")
+		slog.ErrorContext(r.Context(), "Error during row iteration", "err", err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if negotiate(r.Header.Get("Accept"), listMediaTypes) == "text/csv" {
+		writeItemsCSV(w, items, columns)
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// errListQueryTimeout is the cancellation cause of a list query that outran LIST_QUERY_TIMEOUT
+var errListQueryTimeout = errors.New("list query timed out")
+
+// writeListError answers a failed list query. Running out of LIST_QUERY_TIMEOUT is a retryable
+// 503, told apart from the request deadline's 504 by the context's cause; the partial page
+// read so far is discarded.
+func writeListError(ctx context.Context, w http.ResponseWriter, err error, msg string) {
+	if errors.Is(context.Cause(ctx), errListQueryTimeout) {
+		setRetryAfter(w)
+		http.Error(w, "List query timed out; narrow the filters or retry later", http.StatusServiceUnavailable)
+		return
+	}
+	writeDBError(ctx, w, err, msg)
+}
+
+// queryItemCount returns the number of items matched by the list query
+func queryItemCount(ctx context.Context, filter *itemFilter) (int, error) {
+	var count int
+	err := getDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM items"+filter.where(), filter.args...).Scan(&count)
+	return count, err
+}
+
+// countItems writes {"count":N} for the items matched by the list query
+func countItems(w http.ResponseWriter, r *http.Request, filter *itemFilter) {
+	count, err := queryItemCount(r.Context(), filter)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to count items")
+		slog.ErrorContext(r.Context(), "Error counting items", "err", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(items)
+	json.NewEncoder(w).Encode(map[string]int{"count": count})
 }
 
-// getItemByIDHandler retrieves a single item by its ID
-func getItemByIDHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from the URL path using r.PathValue
-	idStr := r.PathValue("id")
-	id, err := strconv.Atoi(idStr)
+// countItemsHandler returns {"count":N} for the items matching the same filters as GET /items
+func countItemsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseItemFilter(tenantFrom(r.Context()), r.URL.Query())
 	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	countItems(w, r, filter)
+}
+
+// parseItemID extracts the {id} path value, writing a 400 and returning false unless it is a positive integer
+func parseItemID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
 		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// getItemByIDHandler retrieves a single item by its ID. The response carries the item's ETag,
+// and a matching If-None-Match is answered with 304 Not Modified.
+func getItemByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseItemID(w, r)
+	if !ok {
 		return
 	}
 
 	var item Item
-	dbMu.Lock()
-	row := db.QueryRow("SELECT id, name FROM items WHERE id = ?", id)
-	dbMu.Unlock()
-	err = row.Scan(&item.ID, &item.Name)
+	row := getDB().QueryRowContext(r.Context(), "SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL", tenantFrom(r.Context()), id)
+	err := row.Scan(item.fields()...)
 	if err == sql.ErrNoRows {
 		http.Error(w, "Item not found", http.StatusNotFound)
 		return
 	}
 	if err != nil {
-		http.Error(w, "Failed to retrieve item", http.StatusInternalServerError)
-		log.Printf("Error querying item by ID: %v", err)
+		writeDBError(r.Context(), w, err, "Failed to retrieve item")
+		slog.ErrorContext(r.Context(), "Error querying item by ID", "err", err)
 		return
 	}
 
+	etag := itemETag(item)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(item)
 }
 
+// getItemByNameHandler retrieves a single item by the URL-decoded ?name= parameter. The name is a
+// query parameter rather than a path segment because /items/by-name/{name} would be ambiguous
+// with /items/{id}/exists. When NameLookupNoCase is set the canonical name_key is matched instead.
+func getItemByNameHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "Invalid item name", http.StatusBadRequest)
+		return
+	}
+
+	query, arg := "SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND name = ? AND deleted_at IS NULL", name
+	if cfg.NameLookupNoCase {
+		query, arg = "SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND name_key = ? AND deleted_at IS NULL ORDER BY id LIMIT 1", nameKey(name)
+	}
+
+	var item Item
+	err := getDB().QueryRowContext(r.Context(), query, tenantFrom(r.Context()), arg).Scan(item.fields()...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to retrieve item")
+		slog.ErrorContext(r.Context(), "Error querying item by name", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// extremeItemHandler serves GET /items/oldest and /items/newest: the item created first or last,
+// with ties on created_at broken by id in the same direction. order is "ASC" or "DESC".
+func extremeItemHandler(order string) http.HandlerFunc {
+	query := "SELECT " + itemColumns + " FROM items WHERE tenant_id = ? AND deleted_at IS NULL ORDER BY created_at " + order + ", id " + order + " LIMIT 1"
+	return func(w http.ResponseWriter, r *http.Request) {
+		var item Item
+		err := getDB().QueryRowContext(r.Context(), query, tenantFrom(r.Context())).Scan(item.fields()...)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No items", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			writeDBError(r.Context(), w, err, "Failed to retrieve item")
+			slog.ErrorContext(r.Context(), "Error querying item by creation time", "err", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	}
+}
+
+// itemExistsHandler reports whether an item exists without transferring the row
+func itemExistsHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseItemID(w, r)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	err := getDB().QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM items WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL)", tenantFrom(r.Context()), id).Scan(&exists)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to check item")
+		slog.ErrorContext(r.Context(), "Error checking item existence", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"exists": exists})
+}
+
 // createItemHandler creates a new item in the database
 func createItemHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
 	var item Item
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeBody(w, r, &item) {
+		return
+	}
+	if rejectInvalidItem(w, &item) {
 		return
 	}
 
-	dbMu.Lock()
-	res, err := db.Exec("INSERT INTO items (name) VALUES (?)", item.Name)
-	dbMu.Unlock()
+	item.CreatedAt = timestamp()
+	item.UpdatedAt = item.CreatedAt
+
+	// Client-supplied ids are only honoured when explicitly enabled; otherwise the id is autoincremented
+	var res sql.Result
+	var err error
+	if cfg.AllowClientIDs && item.ID != 0 {
+		if item.ID < 0 {
+			http.Error(w, "Item ID must be positive", http.StatusBadRequest)
+			return
+		}
+		res, err = getDB().ExecContext(r.Context(), "INSERT INTO items (id, tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+			item.ID, tenantFrom(r.Context()), item.Name, nameKey(item.Name), item.CreatedAt, item.UpdatedAt)
+	} else {
+		res, err = getDB().ExecContext(r.Context(), "INSERT INTO items (tenant_id, name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			tenantFrom(r.Context()), item.Name, nameKey(item.Name), item.CreatedAt, item.UpdatedAt)
+	}
+	if sqliteCode(err) == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY {
+		writeJSONError(w, http.StatusConflict, "item ID already exists")
+		return
+	}
+	if isNameConflict(err) {
+		writeJSONError(w, http.StatusConflict, "item name already exists")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to create item", http.StatusInternalServerError)
-		log.Printf("Error inserting item: %v", err)
+		writeDBError(r.Context(), w, err, "Failed to create item")
+		slog.ErrorContext(r.Context(), "Error inserting item", "err", err)
 		return
 	}
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		http.Error(w, "Failed to get last insert ID", http.StatusInternalServerError)
-		log.Printf("Error getting last insert ID: %v", err)
+		writeDBError(r.Context(), w, err, "Failed to get last insert ID")
+		slog.ErrorContext(r.Context(), "Error getting last insert ID", "err", err)
 		return
 	}
 	item.ID = int(id)
@@ -146,103 +439,360 @@ func createItemHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(item)
 }
 
-// updateItemHandler updates an existing item in the database
+// updateItemHandler updates an existing item in the database. An If-Match header makes the
+// update conditional on the item's current ETag.
 func updateItemHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from the URL path using r.PathValue
-	idStr := r.PathValue("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	id, ok := parseItemID(w, r)
+	if !ok {
 		return
 	}
 
 	var item Item
-	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeBody(w, r, &item) {
+		return
+	}
+	if rejectInvalidItem(w, &item) {
 		return
 	}
 
-	dbMu.Lock()
-	res, err := db.Exec("UPDATE items SET name = ? WHERE id = ?", item.Name, id)
-	dbMu.Unlock()
+	tx, err := getDB().BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, "Failed to update item", http.StatusInternalServerError)
-		log.Printf("Error updating item: %v", err)
+		writeDBError(r.Context(), w, err, "Failed to update item")
+		slog.ErrorContext(r.Context(), "Error beginning update transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+	if !checkIfMatch(w, r, tx, id) {
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
+	// RETURNING reads back created_at, which the body cannot change
+	err = tx.QueryRowContext(r.Context(), "UPDATE items SET name = ?, name_key = ?, updated_at = ? WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL RETURNING "+itemColumns,
+		item.Name, nameKey(item.Name), timestamp(), tenantFrom(r.Context()), id).Scan(item.fields()...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Item not found or no changes made", http.StatusNotFound)
+		return
+	}
+	if isNameConflict(err) {
+		writeJSONError(w, http.StatusConflict, "item name already exists")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to get rows affected", http.StatusInternalServerError)
-		log.Printf("Error getting rows affected: %v", err)
+		writeDBError(r.Context(), w, err, "Failed to update item")
+		slog.ErrorContext(r.Context(), "Error updating item", "err", err)
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Item not found or no changes made", http.StatusNotFound)
+	if err := tx.Commit(); err != nil {
+		writeDBError(r.Context(), w, err, "Failed to update item")
+		slog.ErrorContext(r.Context(), "Error committing update", "err", err)
+		return
+	}
+
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// itemPatch holds the fields of a partial update; nil means the field was omitted
+type itemPatch struct {
+	Name *string `json:"name"`
+}
+
+// patchItemHandler applies a partial update, writing only the fields present in the body.
+// Like PUT, it honours If-Match.
+func patchItemHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	id, ok := parseItemID(w, r)
+	if !ok {
+		return
+	}
+
+	var patch itemPatch
+	if !decodeBody(w, r, &patch) {
+		return
+	}
+
+	var sets []string
+	var args []any
+	if patch.Name != nil {
+		item := Item{Name: *patch.Name}
+		if rejectInvalidItem(w, &item) {
+			return
+		}
+		sets = append(sets, "name = ?", "name_key = ?")
+		args = append(args, item.Name, nameKey(item.Name))
+	}
+	if len(sets) == 0 {
+		http.Error(w, "No updatable fields in request body", http.StatusBadRequest)
+		return
+	}
+	sets = append(sets, "updated_at = ?")
+	args = append(args, timestamp(), tenantFrom(r.Context()), id)
+
+	tx, err := getDB().BeginTx(r.Context(), nil)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to update item")
+		slog.ErrorContext(r.Context(), "Error beginning patch transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+	if !checkIfMatch(w, r, tx, id) {
+		return
+	}
+
+	var item Item
+	err = tx.QueryRowContext(r.Context(), "UPDATE items SET "+strings.Join(sets, ", ")+" WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL RETURNING "+itemColumns, args...).
+		Scan(item.fields()...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Item not found", http.StatusNotFound)
+		return
+	}
+	if isNameConflict(err) {
+		writeJSONError(w, http.StatusConflict, "item name already exists")
+		return
+	}
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to update item")
+		slog.ErrorContext(r.Context(), "Error patching item", "err", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(r.Context(), w, err, "Failed to update item")
+		slog.ErrorContext(r.Context(), "Error committing patch", "err", err)
 		return
 	}
 
-	item.ID = id // Ensure the ID in the response matches the updated item's ID
+	w.Header().Set("ETag", itemETag(item))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(item)
 }
 
-// deleteItemHandler deletes an item from the database
+// deleteItemHandler soft-deletes an item by setting deleted_at, hiding it from every read until it
+// is restored. Its name stays reserved meanwhile. ?purge=true removes the row for good, whether
+// or not it was soft-deleted first. If-Match makes either conditional.
 func deleteItemHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract ID from the URL path using r.PathValue
-	idStr := r.PathValue("id")
-	id, err := strconv.Atoi(idStr)
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	id, ok := parseItemID(w, r)
+	if !ok {
+		return
+	}
+	purge, err := strconv.ParseBool(r.URL.Query().Get("purge"))
+	if err != nil && r.URL.Query().Has("purge") {
+		http.Error(w, "Invalid query: purge must be a boolean", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := getDB().BeginTx(r.Context(), nil)
 	if err != nil {
-		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		writeDBError(r.Context(), w, err, "Failed to delete item")
+		slog.ErrorContext(r.Context(), "Error beginning delete transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+	if !checkIfMatch(w, r, tx, id) {
 		return
 	}
 
-	dbMu.Lock()
-	res, err := db.Exec("DELETE FROM items WHERE id = ?", id)
-	dbMu.Unlock()
+	tenant := tenantFrom(r.Context())
+	query, args := "UPDATE items SET deleted_at = ? WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL", []any{timestamp(), tenant, id}
+	if purge {
+		query, args = "DELETE FROM items WHERE tenant_id = ? AND id = ?", []any{tenant, id}
+	}
+	res, err := tx.ExecContext(r.Context(), query, args...)
 	if err != nil {
-		http.Error(w, "Failed to delete item", http.StatusInternalServerError)
-		log.Printf("Error deleting item: %v", err)
+		writeDBError(r.Context(), w, err, "Failed to delete item")
+		slog.ErrorContext(r.Context(), "Error deleting item", "err", err)
 		return
 	}
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
-		http.Error(w, "Failed to get rows affected", http.StatusInternalServerError)
-		log.Printf("Error getting rows affected: %v", err)
+		writeDBError(r.Context(), w, err, "Failed to get rows affected")
+		slog.ErrorContext(r.Context(), "Error getting rows affected", "err", err)
 		return
 	}
 	if rowsAffected == 0 {
 		http.Error(w, "Item not found", http.StatusNotFound)
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(r.Context(), w, err, "Failed to delete item")
+		slog.ErrorContext(r.Context(), "Error committing delete", "err", err)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent) // 204 No Content for successful deletion
 }
 
+// restoreItemHandler undoes a soft delete, returning the item to every read
+func restoreItemHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	id, ok := parseItemID(w, r)
+	if !ok {
+		return
+	}
+
+	var item Item
+	err := getDB().QueryRowContext(r.Context(), "UPDATE items SET deleted_at = NULL, updated_at = ? WHERE tenant_id = ? AND id = ? AND deleted_at IS NOT NULL RETURNING "+itemColumns,
+		timestamp(), tenantFrom(r.Context()), id).Scan(item.fields()...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No deleted item with that ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to restore item")
+		slog.ErrorContext(r.Context(), "Error restoring item", "err", err)
+		return
+	}
+
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// newServer returns the HTTP server for cfg.Addr, speaking HTTP/2 cleartext as well when H2C is set
+func newServer() *http.Server {
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           newHandler(),
+		ReadHeaderTimeout: cfg.HeaderReadTimeout,
+	}
+	if cfg.H2C {
+		// HTTP/2 without TLS for clients behind a proxy that speaks h2c; HTTP/1.1 stays available
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+		slog.Info("HTTP/2 cleartext (h2c) enabled")
+	}
+	return srv
+}
+
+// newHandler registers every route on a new mux and wraps it in the middleware chain
+func newHandler() http.Handler {
+	// Create a new ServeMux
+	mux := http.NewServeMux()
+
+	// Register specific handlers for each HTTP method and path,
+	// with Cache-Control chosen per route group
+	mux.HandleFunc("GET /items", cacheControl(cfg.CacheControlList, getItemsHandler))
+	mux.HandleFunc("POST /items", cacheControl(cfg.CacheControlMutation, createItemHandler))
+	mux.HandleFunc("POST /items/merge", cacheControl(cfg.CacheControlMutation, mergeItemsHandler))
+	mux.HandleFunc("POST /items/batch", cacheControl(cfg.CacheControlMutation, batchCreateHandler))
+	mux.HandleFunc("POST /items/batch-get-or-create", cacheControl(cfg.CacheControlMutation, batchGetOrCreateHandler))
+	mux.HandleFunc("POST /items/bulk-upsert", cacheControl(cfg.CacheControlMutation, bulkUpsertHandler))
+	mux.HandleFunc("POST /items/replace-all", cacheControl(cfg.CacheControlMutation, replaceAllHandler))
+	mux.HandleFunc("POST /items/import-url", cacheControl(cfg.CacheControlMutation, importURLHandler))
+	mux.HandleFunc("POST /items/search/advanced", cacheControl(cfg.CacheControlMutation, advancedSearchHandler))
+	mux.HandleFunc("GET /items/count", cacheControl(cfg.CacheControlList, countItemsHandler))
+	mux.HandleFunc("GET /items/oldest", cacheControl(cfg.CacheControlItem, extremeItemHandler("ASC")))
+	mux.HandleFunc("GET /items/newest", cacheControl(cfg.CacheControlItem, extremeItemHandler("DESC")))
+	mux.HandleFunc("GET /items/diff", cacheControl(cfg.CacheControlItem, diffItemsHandler))
+	mux.HandleFunc("GET /items/{id}", cacheControl(cfg.CacheControlItem, getItemByIDHandler))
+	mux.HandleFunc("GET /items/{id}/exists", cacheControl(cfg.CacheControlItem, itemExistsHandler))
+	mux.HandleFunc("GET /items/by-name", cacheControl(cfg.CacheControlItem, getItemByNameHandler))
+	mux.HandleFunc("PUT /items/{id}", cacheControl(cfg.CacheControlMutation, updateItemHandler))
+	mux.HandleFunc("PATCH /items/{id}", cacheControl(cfg.CacheControlMutation, patchItemHandler))
+	mux.HandleFunc("DELETE /items/{id}", cacheControl(cfg.CacheControlMutation, deleteItemHandler))
+	mux.HandleFunc("POST /items/{id}/restore", cacheControl(cfg.CacheControlMutation, restoreItemHandler))
+	for i := range resources {
+		registerResource(mux, &resources[i])
+	}
+	mux.HandleFunc("GET /{$}", rootHandler) // GET patterns also match HEAD
+	mux.HandleFunc("GET /healthz", healthzHandler)
+	mux.HandleFunc("GET /readyz", readyzHandler)
+	mux.HandleFunc("GET /stats", statsHandler)
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("POST /admin/optimize", requireAdmin(optimizeHandler))
+
+	// Middleware in the order requests pass through it: trace every request, apply method
+	// overrides so the rest sees the effective method, log and record metrics, gzip large
+	// responses, turn panics into a 500, answer CORS preflights and add CORS headers, so that
+	// preflights cost no tokens and 429s stay readable by browsers, rate limit per client IP and
+	// route, check API keys, resolve the tenant, reject oversized query strings and unacceptable
+	// Accept headers before routing, cut off slow request bodies, and bound each request by the
+	// configured timeout
+	middleware := []func(http.Handler) http.Handler{
+		traceRequests, methodOverride, logRequests, recordMetrics(mux), compressResponses, recoverPanics,
+		cors, rateLimit(mux), requireAPIKey, resolveTenant,
+		limitQueryString, requireAcceptable, bodyReadDeadline, requestTimeout,
+	}
+	var handler http.Handler = mux
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
 func main() {
+	loadConfig()
+	initLogger()
+	if err := validateResources(); err != nil {
+		fatal("Invalid resource definition", "err", err)
+	}
+	checkOpenFileLimit(openFileLimit)
+
 	// Initialize the database connection.
-	initDB("api.db")
+	initDB(cfg.DatabaseURL)
+	primaryDB.Store(getDB())
+	if cfg.SecondaryDBPath != "" {
+		initSecondaryDB(cfg.SecondaryDBPath)
+	}
+	// Runs after the server has shut down and the monitors have stopped
 	defer func() {
-		dbMu.Lock()
-		if err := db.Close(); err != nil {
-			log.Printf("Error closing database: %v", err)
+		if err := primaryDB.Load().Close(); err != nil {
+			slog.Error("Error closing database", "err", err)
+		}
+		if secondaryDB != nil {
+			if err := secondaryDB.Close(); err != nil {
+				slog.Error("Error closing secondary database", "err", err)
+			}
 		}
-		dbMu.Unlock()
 	}()
 
-	// Create a new ServeMux
-	mux := http.NewServeMux()
+	stop := make(chan struct{})
+	defer close(stop)
+	go monitorConnection(stop)
+	go evictVisitors(stop)
+	if secondaryDB != nil {
+		go monitorPrimary(stop)
+	}
+
+	srv := newServer()
 
-	// Register specific handlers for each HTTP method and path
-	mux.HandleFunc("GET /items", getItemsHandler)
-	mux.HandleFunc("POST /items", createItemHandler)
-	mux.HandleFunc("GET /items/{id}", getItemByIDHandler)
-	mux.HandleFunc("PUT /items/{id}", updateItemHandler)
-	mux.HandleFunc("DELETE /items/{id}", deleteItemHandler)
-
-	port := "0.0.0.0:8080"
-	log.Printf("Server starting on port %s", port)
-	// Pass the mux to ListenAndServe
-	log.Fatal(http.ListenAndServe(port, mux))
+	if len(cfg.APIKeys) == 0 {
+		slog.Warn("API_KEYS is unset; every endpoint is reachable without authentication")
+	}
+
+	// Stop accepting connections on SIGINT/SIGTERM and let in-flight requests drain
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	go func() {
+		slog.Info("Server starting", "addr", cfg.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Server failed", "err", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("Shutdown signal received, draining connections", "timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Graceful shutdown did not complete", "err", err)
+	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	resources = []Resource{tagsResource}
+	os.Exit(m.Run())
+}
+
+// setupTest loads the default configuration with rate limiting off, applies configure, opens a
+// fresh database in a temporary directory and returns the full handler chain main would serve
+func setupTest(t testing.TB, configure ...func(*Config)) http.Handler {
+	t.Helper()
+	cfg = envConfig()
+	cfg.DatabaseURL = filepath.Join(t.TempDir(), "test.db")
+	cfg.RateLimitRPS = 0
+	for _, f := range configure {
+		f(&cfg)
+	}
+
+	visitorsMu.Lock()
+	visitors = map[string]*visitor{}
+	visitorsMu.Unlock()
+	failedOver.Store(false)
+	secondaryDB = nil
+
+	initDB(cfg.DatabaseURL)
+	primaryDB.Store(getDB())
+	t.Cleanup(func() { primaryDB.Load().Close() })
+	return newHandler()
+}
+
+// serve sends a request with an optional body through h and returns the recorded response.
+// headers are name, value pairs.
+func serve(h http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body != "" {
+		r = httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCreateAndGetItem(t *testing.T) {
+	h := setupTest(t)
+
+	w := serve(h, "POST", "/items", `{"name":"apple"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %q", w.Code, w.Body)
+	}
+	w = serve(h, "GET", "/items/1", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"apple"`) {
+		t.Fatalf("get: status %d, body %q", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/items/2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get missing: status %d, want 404", w.Code)
+	}
+}
+
+func TestCreateItemClientID(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.AllowClientIDs = true })
+
+	tests := []struct {
+		name, body string
+		want       int
+		wantID     float64
+	}{
+		{"client id", `{"id":10,"name":"apple"}`, http.StatusCreated, 10},
+		{"collision", `{"id":10,"name":"banana"}`, http.StatusConflict, 0},
+		{"omitted", `{"name":"cherry"}`, http.StatusCreated, 11},
+		{"negative", `{"id":-1,"name":"damson"}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		w := serve(h, "POST", "/items", tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d, body %q", tt.name, w.Code, tt.want, w.Body)
+			continue
+		}
+		var item map[string]any
+		json.Unmarshal(w.Body.Bytes(), &item)
+		if tt.wantID != 0 && item["id"] != tt.wantID {
+			t.Errorf("%s: id %v, want %v", tt.name, item["id"], tt.wantID)
+		}
+	}
+}
+
+func TestCreateItemClientIDDisabled(t *testing.T) {
+	h := setupTest(t)
+
+	w := serve(h, "POST", "/items", `{"id":10,"name":"apple"}`)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), `"id":1,`) {
+		t.Errorf("status %d, body %q, want the id autoincremented to 1", w.Code, w.Body)
+	}
+}
+
+func TestGetItemsEmpty(t *testing.T) {
+	h := setupTest(t)
+
+	for _, target := range []string{"/items", "/tags"} {
+		if w := serve(h, "GET", target, ""); strings.TrimSpace(w.Body.String()) != "[]" {
+			t.Errorf("GET %s on an empty table: %q, want []", target, w.Body)
+		}
+	}
+}
+
+// createItems posts an item for each name, failing the test on any error
+func createItems(t *testing.T, h http.Handler, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if w := serve(h, "POST", "/items", `{"name":"`+name+`"}`); w.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d, body %q", name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestItemExists(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple")
+
+	for target, want := range map[string]string{"/items/1/exists": "true", "/items/2/exists": "false"} {
+		w := serve(h, "GET", target, "")
+		if w.Code != http.StatusOK || w.Body.String() != `{"exists":`+want+"}\n" {
+			t.Errorf("%s: status %d, body %q, want 200 with exists %s", target, w.Code, w.Body, want)
+		}
+	}
+}
+
+func TestCountOnly(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple", "pineapple", "banana", "grape")
+
+	for _, query := range []string{"", "name=apple", "name_prefix=b", "created_today=true", "name=zzz"} {
+		list := itemNames(t, serve(h, "GET", "/items?"+query, "").Body.Bytes())
+		w := serve(h, "GET", "/items?count_only=true&"+query, "")
+		if want := fmt.Sprintf(`{"count":%d}`+"\n", len(list)); w.Body.String() != want {
+			t.Errorf("?%s: count %q, want %q", query, w.Body, want)
+		}
+	}
+	if w := serve(h, "GET", "/items?count_only=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid count_only: status %d, want 400", w.Code)
+	}
+}
+
+func TestInvalidItemID(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple")
+
+	routes := []struct{ method, path, body string }{
+		{"GET", "/items/%s", ""},
+		{"GET", "/items/%s/exists", ""},
+		{"PUT", "/items/%s", `{"name":"pear"}`},
+		{"PATCH", "/items/%s", `{"name":"pear"}`},
+		{"DELETE", "/items/%s", ""},
+		{"POST", "/items/%s/restore", ""},
+	}
+	for _, id := range []string{"0", "-5", "99999999999999999999", "abc"} {
+		for _, route := range routes {
+			target := fmt.Sprintf(route.path, id)
+			w := serve(h, route.method, target, route.body)
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid item ID") {
+				t.Errorf("%s %s: status %d, body %q, want 400", route.method, target, w.Code, w.Body)
+			}
+		}
+	}
+}
+
+func TestIncludeCount(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple", "pineapple", "banana", "grape")
+
+	w := serve(h, "GET", "/items?name=apple&limit=1", "", "X-Include-Count", "true")
+	if got := w.Header().Get("X-Total-Count"); got != "2" {
+		t.Errorf("X-Total-Count %q, want the 2 matching items", got)
+	}
+	if names := itemNames(t, w.Body.Bytes()); len(names) != 1 {
+		t.Errorf("page %q, want one item", names)
+	}
+	if w := serve(h, "GET", "/items", ""); w.Header().Get("X-Total-Count") != "" {
+		t.Error("X-Total-Count sent without X-Include-Count")
+	}
+}
+
+func TestGetItemByName(t *testing.T) {
+	for _, noCase := range []bool{false, true} {
+		h := setupTest(t, func(c *Config) { c.NameLookupNoCase = noCase })
+		createItems(t, h, "Crème Brûlée", "a&b")
+		differentCase := http.StatusNotFound
+		if noCase {
+			differentCase = http.StatusOK
+		}
+
+		tests := []struct {
+			name, query string
+			want        int
+		}{
+			{"exact case", "name=Cr%C3%A8me%20Br%C3%BBl%C3%A9e", http.StatusOK},
+			{"reserved characters", "name=a%26b", http.StatusOK},
+			{"different case", "name=CR%C3%88ME%20BR%C3%9BL%C3%89E", differentCase},
+			{"miss", "name=custard", http.StatusNotFound},
+			{"empty", "name=", http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			if w := serve(h, "GET", "/items/by-name?"+tt.query, ""); w.Code != tt.want {
+				t.Errorf("case-insensitive %v, %s: status %d, want %d", noCase, tt.name, w.Code, tt.want)
+			}
+		}
+	}
+}
+
+func TestH2C(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		setupTest(t, func(c *Config) { c.H2C = enabled })
+		srv := newServer()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go srv.Serve(ln)
+
+		// A client that speaks only HTTP/2 without TLS, as an h2c proxy would
+		transport := &http.Transport{Protocols: new(http.Protocols)}
+		transport.Protocols.SetUnencryptedHTTP2(true)
+		resp, err := (&http.Client{Transport: transport}).Get("http://" + ln.Addr().String() + "/items")
+		if enabled {
+			if err != nil {
+				t.Fatalf("h2c request: %v", err)
+			}
+			if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+				t.Errorf("h2c request: status %d over %s, want 200 over HTTP/2", resp.StatusCode, resp.Proto)
+			}
+			resp.Body.Close()
+		} else if err == nil {
+			resp.Body.Close()
+			t.Errorf("h2c request succeeded with H2C off, over %s", resp.Proto)
+		}
+
+		// HTTP/1.1 works either way
+		resp, err = http.Get("http://" + ln.Addr().String() + "/items")
+		if err != nil || resp.ProtoMajor != 1 {
+			t.Errorf("H2C %v: HTTP/1.1 request failed: %v", enabled, err)
+		} else {
+			resp.Body.Close()
+		}
+		transport.CloseIdleConnections()
+		srv.Close()
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple", "banana")
+
+	var mode string
+	getDB().QueryRow("PRAGMA journal_mode").Scan(&mode)
+	if mode != "wal" {
+		t.Errorf("journal_mode %q, want wal", mode)
+	}
+
+	// A reader part-way through its rows and a writer holding the write lock each keep a
+	// connection busy; other reads must still go through on their own connections
+	rows, err := getDB().Query("SELECT id FROM items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	rows.Next()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	tx, err := getDB().BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("writer blocked behind an open reader: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("INSERT INTO items (name) VALUES ('uncommitted')"); err != nil {
+		t.Fatal(err)
+	}
+
+	const readers = 8
+	errs := make(chan string, readers)
+	for range readers {
+		go func() {
+			w := serve(h, "GET", "/items", "")
+			var items []Item
+			if err := json.Unmarshal(w.Body.Bytes(), &items); err != nil || len(items) != 2 {
+				errs <- fmt.Sprintf("status %d, body %q", w.Code, w.Body)
+				return
+			}
+			errs <- ""
+		}()
+	}
+	timeout := time.After(2 * time.Second)
+	for range readers {
+		select {
+		case msg := <-errs:
+			if msg != "" {
+				t.Errorf("concurrent read: %s", msg)
+			}
+		case <-timeout:
+			t.Fatal("reads blocked behind an open reader and writer")
+		}
+	}
+}
+
+func BenchmarkParallelReads(b *testing.B) {
+	h := setupTest(b)
+	for i := range 100 {
+		serve(h, "POST", "/items", fmt.Sprintf(`{"name":"item-%d"}`, i))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if w := serve(h, "GET", "/items?limit=20", ""); w.Code != http.StatusOK {
+				b.Errorf("status %d", w.Code)
+			}
+		}
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple", "banana")
+	getDB().Exec("UPDATE items SET updated_at = '2000-01-01T00:00:00Z'")
+	etag := serve(h, "GET", "/items/1", "").Header().Get("ETag")
+
+	if w := serve(h, "DELETE", "/items/1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", w.Code)
+	}
+	if w := serve(h, "GET", "/items/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("get deleted item: status %d, want 404", w.Code)
+	}
+	if got := itemNames(t, serve(h, "GET", "/items", "").Body.Bytes()); !slices.Equal(got, []string{"banana"}) {
+		t.Errorf("list %q, want [banana]", got)
+	}
+
+	// include_deleted lists the deleted item too, marked with its deleted_at
+	w := serve(h, "GET", "/items?include_deleted=true", "")
+	var items []Item
+	json.Unmarshal(w.Body.Bytes(), &items)
+	if len(items) != 2 || items[0].DeletedAt == nil || items[1].DeletedAt != nil {
+		t.Errorf("include_deleted listed %+v, want apple deleted and banana live", items)
+	}
+	if w := serve(h, "GET", "/items?include_deleted=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("include_deleted=maybe: status %d, want 400", w.Code)
+	}
+
+	// Restoring writes a new updated_at, so an ETag from before the delete no longer matches
+	w = serve(h, "POST", "/items/1/restore", "")
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("restore: status %d, ETag %q, want 200 and a new ETag", w.Code, w.Header().Get("ETag"))
+	}
+	if w := serve(h, "PUT", "/items/1", `{"name":"apricot"}`, "If-Match", etag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with the pre-delete ETag: status %d, want 412", w.Code)
+	}
+	if w := serve(h, "POST", "/items/1/restore", ""); w.Code != http.StatusNotFound {
+		t.Errorf("restore a live item: status %d, want 404", w.Code)
+	}
+
+	// purge removes the row for good: it cannot be restored and include_deleted no longer lists it
+	if w := serve(h, "DELETE", "/items/1?purge=maybe", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("purge=maybe: status %d, want 400", w.Code)
+	}
+	if w := serve(h, "DELETE", "/items/1?purge=true", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("purge: status %d", w.Code)
+	}
+	if w := serve(h, "POST", "/items/1/restore", ""); w.Code != http.StatusNotFound {
+		t.Errorf("restore a purged item: status %d, want 404", w.Code)
+	}
+	if got := itemNames(t, serve(h, "GET", "/items?include_deleted=true", "").Body.Bytes()); !slices.Equal(got, []string{"banana"}) {
+		t.Errorf("include_deleted after purge lists %q, want [banana]", got)
+	}
+}
+
+func TestOldestAndNewest(t *testing.T) {
+	h := setupTest(t)
+	for _, target := range []string{"/items/oldest", "/items/newest"} {
+		if w := serve(h, "GET", target, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s on an empty table: status %d, want 404", target, w.Code)
+		}
+	}
+
+	createItems(t, h, "middle", "first", "tied-a", "tied-b", "deleted")
+	for name, created := range map[string]string{
+		"middle":  "2024-02-01T00:00:00Z",
+		"first":   "2024-01-01T00:00:00Z",
+		"tied-a":  "2024-03-01T00:00:00Z",
+		"tied-b":  "2024-03-01T00:00:00Z",
+		"deleted": "2025-01-01T00:00:00Z",
+	} {
+		getDB().Exec("UPDATE items SET created_at = ? WHERE name = ?", created, name)
+	}
+	serve(h, "DELETE", "/items/5", "")
+
+	// Ties on created_at go to the lower id for oldest and the higher id for newest
+	for target, want := range map[string]string{"/items/oldest": `"name":"first"`, "/items/newest": `"name":"tied-b"`} {
+		if w := serve(h, "GET", target, ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: status %d, body %q, want %s", target, w.Code, w.Body, want)
+		}
+	}
+}
+
+func TestListQueryTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("seeds 100,000 items")
+	}
+	h := setupTest(t, func(c *Config) { c.ListQueryTimeout = 5 * time.Millisecond })
+
+	// Enough rows that a substring filter matching none of them scans for well over the timeout
+	_, err := getDB().Exec(`WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 100000)
+		INSERT INTO items (name, name_key, created_at, updated_at) SELECT 'item-' || i, 'item-' || i, '2024-01-01T00:00:00Z', '2024-01-01T00:00:00Z' FROM n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	w := serve(h, "GET", "/items?name=no-such-item", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "List query timed out") {
+		t.Fatalf("slow list: status %d, body %q, want 503", w.Code, w.Body)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("slow list: no Retry-After")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow list took %v, want it cancelled near the timeout", elapsed)
+	}
+	if inUse := getDB().Stats().InUse; inUse != 0 {
+		t.Errorf("%d connections still in use after the cancelled query", inUse)
+	}
+
+	cfg.ListQueryTimeout = time.Minute
+	if w := serve(h, "GET", "/items?limit=1", ""); w.Code != http.StatusOK {
+		t.Errorf("list after the timeout: status %d, body %q", w.Code, w.Body)
+	}
+}
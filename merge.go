@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// mergeRequest identifies the item to fold away and the item that survives
+type mergeRequest struct {
+	From int `json:"from"`
+	Into int `json:"into"`
+}
+
+// mergeItemsHandler merges one item into another, soft-deleting the source and returning the survivor.
+// Items have no dependent rows yet; anything referencing an item should be reassigned here.
+func mergeItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	var req mergeRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.From <= 0 || req.Into <= 0 {
+		http.Error(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+	if req.From == req.Into {
+		http.Error(w, "Cannot merge an item into itself", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := getDB().BeginTx(r.Context(), nil)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to merge items")
+		slog.ErrorContext(r.Context(), "Error beginning merge transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var item Item
+	err = tx.QueryRowContext(r.Context(), "SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL", tenantFrom(r.Context()), req.Into).Scan(item.fields()...)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Target item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to merge items")
+		slog.ErrorContext(r.Context(), "Error querying merge target", "err", err)
+		return
+	}
+
+	res, err := tx.ExecContext(r.Context(), "UPDATE items SET deleted_at = ? WHERE tenant_id = ? AND id = ? AND deleted_at IS NULL", timestamp(), tenantFrom(r.Context()), req.From)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to merge items")
+		slog.ErrorContext(r.Context(), "Error deleting merge source", "err", err)
+		return
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to get rows affected")
+		slog.ErrorContext(r.Context(), "Error getting rows affected", "err", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Source item not found", http.StatusNotFound)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(r.Context(), w, err, "Failed to merge items")
+		slog.ErrorContext(r.Context(), "Error committing merge", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
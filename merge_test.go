@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMergeItems(t *testing.T) {
+	h := setupTest(t)
+	serve(h, "POST", "/items", `{"name":"apple"}`)
+	serve(h, "POST", "/items", `{"name":"apples"}`)
+
+	w := serve(h, "POST", "/items/merge", `{"from":2,"into":1}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("merge: status %d, body %q", w.Code, w.Body)
+	}
+	var item Item
+	json.Unmarshal(w.Body.Bytes(), &item)
+	if item.ID != 1 || item.Name != "apple" {
+		t.Errorf("merge returned %+v, want item 1", item)
+	}
+	if w := serve(h, "GET", "/items/2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("source after merge: status %d, want 404", w.Code)
+	}
+	if w := serve(h, "GET", "/items/1", ""); w.Code != http.StatusOK {
+		t.Errorf("target after merge: status %d, want 200", w.Code)
+	}
+}
+
+func TestMergeItemsRejects(t *testing.T) {
+	h := setupTest(t)
+	serve(h, "POST", "/items", `{"name":"apple"}`)
+	serve(h, "POST", "/items", `{"name":"banana"}`)
+
+	tests := []struct {
+		name, body string
+		want       int
+	}{
+		{"self", `{"from":1,"into":1}`, http.StatusBadRequest},
+		{"missing id", `{"into":1}`, http.StatusBadRequest},
+		{"unknown source", `{"from":9,"into":1}`, http.StatusNotFound},
+		{"unknown target", `{"from":2,"into":9}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(h, "POST", "/items/merge", tt.body); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d, body %q", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+	if w := serve(h, "GET", "/items/count", ""); w.Body.String() != `{"count":2}`+"\n" {
+		t.Errorf("rejected merges changed the items: count %q", w.Body)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by method, route pattern and status code.",
+	}, []string{"method", "path", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by method and route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "path"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "db_open_connections",
+		Help: "Open connections to the database, in use or idle.",
+	}, func() float64 {
+		return float64(getDB().Stats().OpenConnections)
+	})
+)
+
+// metricMethods are the methods that get their own method label; anything else a client sends
+// is counted as "other", so made-up methods cannot add series
+var metricMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true, http.MethodPut: true,
+	http.MethodPatch: true, http.MethodDelete: true, http.MethodOptions: true,
+}
+
+// recordMetrics counts each request and observes its duration for GET /metrics. The path label
+// is the route pattern mux matches, e.g. /items/{id}, so ids do not multiply the series;
+// requests matching no route share the label "unmatched". Unknown methods are labelled "other".
+func recordMetrics(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := "unmatched"
+			if _, pattern := mux.Handler(r); pattern != "" {
+				// Patterns carry their method, "GET /items/{id}", which has its own label
+				_, path, _ = strings.Cut(pattern, " ")
+			}
+
+			method := r.Method
+			if !metricMethods[method] {
+				method = "other"
+			}
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			httpRequests.WithLabelValues(method, path, strconv.Itoa(rec.status)).Inc()
+			httpRequestDuration.WithLabelValues(method, path).Observe(time.Since(start).Seconds())
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRecordMetricsLabels(t *testing.T) {
+	h := setupTest(t)
+
+	serve(h, "GET", "/items/42", "")
+	serve(h, "BREW", "/items/42", "")
+	serve(h, "GET", "/no/such/route", "")
+
+	w := serve(h, "GET", "/metrics", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`http_requests_total{code="404",method="GET",path="/items/{id}"}`,
+		`http_requests_total{code="405",method="other",path="unmatched"}`,
+		`http_requests_total{code="404",method="GET",path="unmatched"}`,
+		`db_open_connections `,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %s", want)
+		}
+	}
+	if strings.Contains(body, `method="BREW"`) {
+		t.Error("an unknown method got its own label")
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// recoverPanics turns a panic in any handler into a logged stack trace and a generic 500, so one
+// bad request cannot take the process down, and reports it to PANIC_WEBHOOK when that is set.
+// http.ErrAbortHandler is re-raised to keep its meaning.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			stack := string(debug.Stack())
+			slog.ErrorContext(r.Context(), "Panic serving request", "method", r.Method, "path", r.URL.Path,
+				"panic", fmt.Sprint(rec), "stack", stack)
+			reportPanic(r, fmt.Sprint(rec), stack)
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// panicClient posts panic reports; the timeout keeps a slow receiver from piling up goroutines
+var panicClient = &http.Client{Timeout: 5 * time.Second}
+
+// reportPanic POSTs a JSON report of a panic raised while serving r to PANIC_WEBHOOK in the
+// background. The request id is the trace id its log lines carry. Reporting is best effort: a
+// failure, or a panic while reporting, is logged and never reaches the client or the process.
+func reportPanic(r *http.Request, panicValue, stack string) {
+	webhook := cfg.PanicWebhook
+	if webhook == "" {
+		return
+	}
+	report := map[string]string{
+		"service": serviceName,
+		"panic":   panicValue,
+		"stack":   stack,
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"time":    timestamp(),
+	}
+	ctx := context.WithoutCancel(r.Context())
+	if t, ok := traceFrom(ctx); ok {
+		report["request_id"] = t.TraceID
+	}
+
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				slog.ErrorContext(ctx, "Panic sending panic report", "panic", fmt.Sprint(rec))
+			}
+		}()
+		body, _ := json.Marshal(report)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to build panic report", "err", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if t, ok := traceFrom(ctx); ok {
+			req.Header.Set("traceparent", t.traceparent())
+		}
+		resp, err := panicClient.Do(req)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to send panic report", "err", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			slog.ErrorContext(ctx, "Panic report was rejected", "status", resp.StatusCode)
+		}
+	}()
+}
+
+const (
+	corsAllowMethods  = "GET, POST, PUT, PATCH, DELETE"
+	corsAllowHeaders  = "Authorization, Content-Type, If-Match, If-None-Match, X-API-Key, X-HTTP-Method-Override, X-Include-Count, X-Tenant-ID, traceparent"
+	corsExposeHeaders = "X-Total-Count, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, ETag, traceparent"
+)
+
+// cors adds CORS headers for origins listed in CORS_ALLOWED_ORIGINS and answers preflight
+// OPTIONS requests with 204. Requests from other origins get no CORS headers, so the browser
+// blocks them; same-origin and non-browser clients are unaffected.
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(cfg.CORSAllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := ""
+		for _, o := range cfg.CORSAllowedOrigins {
+			if o == "*" {
+				allowed = "*"
+				break
+			}
+			if o == origin {
+				allowed = origin
+			}
+		}
+		if allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitQueryString rejects requests whose raw query string is too long (414) or carries too
+// many parameters (400) before the mux or any handler parses it
+func limitQueryString(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.URL.RawQuery
+		if len(raw) > cfg.MaxQueryLength {
+			http.Error(w, fmt.Sprintf("Query string exceeds %d bytes", cfg.MaxQueryLength), http.StatusRequestURITooLong)
+			return
+		}
+		if raw != "" && strings.Count(raw, "&")+1 > cfg.MaxQueryParams {
+			http.Error(w, fmt.Sprintf("Query string exceeds %d parameters", cfg.MaxQueryParams), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// overridableMethods are the methods a POST may be rewritten to by methodOverride
+var overridableMethods = map[string]bool{http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true}
+
+// rawQueryValue returns the first value of key in a raw query string. It stops at the match
+// rather than parsing the whole query, since methodOverride runs before limitQueryString.
+func rawQueryValue(raw, key string) string {
+	for raw != "" {
+		var pair string
+		pair, raw, _ = strings.Cut(raw, "&")
+		if k, v, _ := strings.Cut(pair, "="); k == key {
+			v, err := url.QueryUnescape(v)
+			if err != nil {
+				return ""
+			}
+			return v
+		}
+	}
+	return ""
+}
+
+// methodOverride lets clients behind proxies that block PUT, PATCH or DELETE send a POST naming
+// the intended method in X-HTTP-Method-Override or ?_method=. The method is rewritten before
+// routing, so the request reaches that method's handler. Only those three methods are accepted.
+// It is enabled by METHOD_OVERRIDE.
+func methodOverride(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.MethodOverride || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		method := r.Header.Get("X-HTTP-Method-Override")
+		if method == "" {
+			method = rawQueryValue(r.URL.RawQuery, "_method")
+		}
+		if method != "" {
+			method = strings.ToUpper(method)
+			if !overridableMethods[method] {
+				http.Error(w, "Method override must be one of PUT, PATCH or DELETE", http.StatusBadRequest)
+				return
+			}
+			r.Method = method
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestTimeout bounds each request's context by cfg.RequestTimeout. Handlers pass r.Context()
+// to every database call, so a slow query or a client that disconnects releases its connection
+// and the handler answers 504 or 503 through writeDBError.
+func requestTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RequestTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// bodyReadDeadline gives each request cfg.BodyReadTimeout to deliver its body, so a client that
+// dribbles bytes is cut off instead of holding a handler and its connection open. Reads past
+// the deadline fail and decodeBody answers 408. Requests without a body are left alone.
+func bodyReadDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != 0 {
+			// Not every connection supports deadlines (ErrNotSupported); those fall back to REQUEST_TIMEOUT
+			http.NewResponseController(w).SetReadDeadline(time.Now().Add(cfg.BodyReadTimeout))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheControl wraps a route handler so successful responses carry the given Cache-Control value.
+// Error responses are left uncached by omission.
+func cacheControl(value string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+	}
+}
+
+// cacheControlWriter sets Cache-Control just before the status line is written, once the status is known
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if code < http.StatusBadRequest && cw.value != "" {
+			cw.Header().Set("Cache-Control", cw.value)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /panic", func(w http.ResponseWriter, r *http.Request) {
+		var item *Item
+		_ = item.Name // nil dereference
+	})
+	mux.HandleFunc("GET /ok", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	srv := httptest.NewServer(recoverPanics(mux))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/panic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), `"internal server error"`) {
+		t.Errorf("body %q, want the generic JSON error", body)
+	}
+
+	// The server keeps serving after the panic
+	resp, err = http.Get(srv.URL + "/ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("after panic: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestRecoverPanicsReraisesAbort(t *testing.T) {
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", rec)
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestPanicReport(t *testing.T) {
+	reports := make(chan map[string]string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report map[string]string
+		json.NewDecoder(r.Body).Decode(&report)
+		reports <- report
+	}))
+	defer receiver.Close()
+
+	cfg = Config{PanicWebhook: receiver.URL}
+	h := traceRequests(recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	w := serve(h, "DELETE", "/items/7", "", "traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", w.Code)
+	}
+
+	select {
+	case report := <-reports:
+		if report["panic"] != "boom" || report["request_id"] != traceID || report["method"] != "DELETE" ||
+			report["path"] != "/items/7" || !strings.Contains(report["stack"], "recoverPanics") {
+			t.Errorf("report %v", report)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no panic report was delivered")
+	}
+
+	// An unreachable receiver is only logged; the client still gets its 500
+	receiver.Close()
+	if w := serve(h, "GET", "/", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("with the receiver down: status %d, want 500", w.Code)
+	}
+}
+
+func TestMethodOverride(t *testing.T) {
+	h := setupTest(t)
+	serve(h, "POST", "/items", `{"name":"apple"}`)
+
+	// Off by default: the POST is routed as a POST, which /items/{id} does not accept
+	if w := serve(h, "POST", "/items/1?_method=DELETE", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("override disabled: status %d, want 405", w.Code)
+	}
+
+	cfg.MethodOverride = true
+	if w := serve(h, "POST", "/items/1", "", "X-HTTP-Method-Override", "GET"); w.Code != http.StatusBadRequest {
+		t.Errorf("override to GET: status %d, want 400", w.Code)
+	}
+	if w := serve(h, "POST", "/items/1?x=1&_method=delete", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("override to DELETE: status %d, want 204", w.Code)
+	}
+	if w := serve(h, "GET", "/items/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("after delete: status %d, want 404", w.Code)
+	}
+}
+
+func TestRawQueryValue(t *testing.T) {
+	tests := []struct{ raw, want string }{
+		{"", ""},
+		{"_method=PUT", "PUT"},
+		{"a=1&_method=PATCH&_method=PUT", "PATCH"},
+		{"a=%zz&_method=DELETE", "DELETE"},
+		{"_method=%zz", ""},
+		{"x_method=PUT", ""},
+	}
+	for _, tt := range tests {
+		if got := rawQueryValue(tt.raw, "_method"); got != tt.want {
+			t.Errorf("rawQueryValue(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestLimitQueryString(t *testing.T) {
+	h := setupTest(t, func(c *Config) {
+		c.MaxQueryLength = 64
+		c.MaxQueryParams = 4
+	})
+
+	tests := []struct {
+		name, query string
+		want        int
+	}{
+		{"within limits", "name=apple&limit=2", http.StatusOK},
+		{"too long", "name=" + strings.Repeat("a", 60), http.StatusRequestURITooLong},
+		{"too many parameters", "a=1&b=2&c=3&d=4&e=5", http.StatusBadRequest},
+		{"at parameter limit", "a=1&b=2&c=3&d=4", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(h, "GET", "/items?"+tt.query, ""); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d, body %q", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	h := setupTest(t)
+
+	tests := []struct {
+		name, method, target, body, want string
+	}{
+		{"mutation", "POST", "/items", `{"name":"apple"}`, "no-store"},
+		{"list", "GET", "/items", "", "private, max-age=60"},
+		{"item", "GET", "/items/1", "", "no-cache"},
+		{"error", "GET", "/items/9", "", ""},
+		{"update", "PUT", "/items/1", `{"name":"pear"}`, "no-store"},
+		{"advanced search", "POST", "/items/search/advanced", `{}`, "no-store"},
+	}
+	for _, tt := range tests {
+		if got := serve(h, tt.method, tt.target, tt.body).Header().Get("Cache-Control"); got != tt.want {
+			t.Errorf("%s: Cache-Control %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBodyReadDeadline(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.BodyReadTimeout = 100 * time.Millisecond })
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Send the headers and then dribble the body a byte at a time, as a slowloris client would
+	body := `{"name":"apple"}`
+	fmt.Fprintf(conn, "POST /items HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n", len(body))
+	start := time.Now()
+	go func() {
+		for i := range len(body) {
+			if _, err := conn.Write([]byte{body[i]}); err != nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("slow body: status %d, want 408", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("slow body was cut off after %v, want about 100ms", elapsed)
+	}
+	if w := serve(h, "GET", "/items/by-name?name=apple", ""); w.Code != http.StatusNotFound {
+		t.Errorf("aborted request created the item: status %d", w.Code)
+	}
+
+	resp, err = http.Post(srv.URL+"/items", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("prompt body: status %d, want 201", resp.StatusCode)
+	}
+}
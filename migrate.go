@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// createItemsTable is the current definition of the items table, with %s for its name. Names are
+// unique per tenant; migrateNameKey adds the unique index on canonical names.
+const createItemsTable = `
+	CREATE TABLE IF NOT EXISTS %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		tenant_id TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		name_key TEXT,
+		created_at TEXT,
+		updated_at TEXT,
+		deleted_at TEXT,
+		UNIQUE (tenant_id, name)
+	);`
+
+// migrateDB brings a database created by an older version of the schema up to date
+func migrateDB() {
+	if err := migrateTenantID(); err != nil {
+		fatal("Failed to migrate tenant_id", "err", err)
+	}
+	if err := migrateNameKey(); err != nil {
+		fatal("Failed to migrate name_key", "err", err)
+	}
+	if err := migrateTimestamps(); err != nil {
+		fatal("Failed to migrate timestamps", "err", err)
+	}
+	if err := migrateDeletedAt(); err != nil {
+		fatal("Failed to migrate deleted_at", "err", err)
+	}
+	for i := range resources {
+		if err := resources[i].ensureTable(); err != nil {
+			fatal("Failed to create table", "table", resources[i].Table, "err", err)
+		}
+	}
+}
+
+// schemaColumns lists the columns of items that the handlers read or write
+var schemaColumns = []string{"id", "tenant_id", "name", "name_key", "created_at", "updated_at", "deleted_at"}
+
+// verifySchema checks that an externally managed database has every column the handlers use,
+// so a missing table or migration fails at startup rather than on the first request
+func verifySchema() error {
+	for _, column := range schemaColumns {
+		ok, err := hasColumn("items", column)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("table items is missing column %q", column)
+		}
+	}
+	for i := range resources {
+		if err := resources[i].verifyTable(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasColumn reports whether table already has the named column
+func hasColumn(table, column string) (bool, error) {
+	rows, err := getDB().Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// migrateTenantID moves the items written before tenancy into the default tenant. Names become
+// unique per tenant, and SQLite cannot drop the inline UNIQUE on name with ALTER TABLE, so the
+// table is rebuilt: copied into a new table with the current definition, which then takes its
+// place. Ids and the AUTOINCREMENT counter carry over; migrateNameKey recreates the name_key index.
+func migrateTenantID() error {
+	ok, err := hasColumn("items", "tenant_id")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := rebuildItemsWithTenant(); err != nil {
+			return err
+		}
+	}
+	// Every query is scoped to a tenant; without this index SQLite picks the (tenant_id, name)
+	// index and sorts the tenant's whole table to page through it in id order
+	_, err = getDB().Exec("CREATE INDEX IF NOT EXISTS idx_items_tenant ON items (tenant_id)")
+	return err
+}
+
+// rebuildItemsWithTenant copies items into a table with the current definition, see migrateTenantID
+func rebuildItemsWithTenant() error {
+	var columns []string
+	for _, column := range schemaColumns {
+		has, err := hasColumn("items", column)
+		if err != nil {
+			return err
+		}
+		if has {
+			columns = append(columns, column)
+		}
+	}
+	list := strings.Join(columns, ", ")
+
+	tx, err := getDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var seq sql.NullInt64
+	if err := tx.QueryRow("SELECT seq FROM sqlite_sequence WHERE name = 'items'").Scan(&seq); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf(createItemsTable, "items_rebuild")); err != nil {
+		return err
+	}
+	res, err := tx.Exec("INSERT INTO items_rebuild (" + list + ") SELECT " + list + " FROM items")
+	if err != nil {
+		return err
+	}
+	copied, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range []string{"DROP TABLE items", "ALTER TABLE items_rebuild RENAME TO items"} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	// Deleting the highest ids must not let them be handed out again
+	if seq.Valid {
+		if _, err := tx.Exec("DELETE FROM sqlite_sequence WHERE name = 'items'"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO sqlite_sequence (name, seq) VALUES ('items', ?)", seq.Int64); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("Rebuilt table 'items' with per-tenant names, existing items are in the default tenant", "items", copied)
+	return nil
+}
+
+// migrateNameKey adds and backfills the canonical name_key column, then creates or drops
+// its unique index depending on cfg.CanonicalNames. It runs in one transaction, so a database
+// whose names collide on their keys is left as it was.
+func migrateNameKey() error {
+	ok, err := hasColumn("items", "name_key")
+	if err != nil {
+		return err
+	}
+	tx, err := getDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !ok {
+		if _, err := tx.Exec("ALTER TABLE items ADD COLUMN name_key TEXT"); err != nil {
+			return err
+		}
+	}
+	n, err := backfillNameKeys(tx)
+	if err != nil {
+		return err
+	}
+
+	if cfg.CanonicalNames {
+		if err := checkNameKeyCollisions(tx); err != nil {
+			return err
+		}
+		_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_items_name_key ON items (tenant_id, name_key)")
+	} else {
+		_, err = tx.Exec("DROP INDEX IF EXISTS idx_items_name_key")
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if !ok {
+		slog.Info("Added column 'name_key' to table 'items'")
+	}
+	if n > 0 {
+		slog.Info("Backfilled name_key", "items", n)
+	}
+	return nil
+}
+
+// backfillNameKeys fills name_key for rows written before the column existed and returns how many it filled
+func backfillNameKeys(tx *sql.Tx) (int, error) {
+	rows, err := tx.Query("SELECT id, name FROM items WHERE name_key IS NULL")
+	if err != nil {
+		return 0, err
+	}
+	var pending []Item
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(&item.ID, &item.Name); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, item := range pending {
+		if _, err := tx.Exec("UPDATE items SET name_key = ? WHERE id = ?", nameKey(item.Name), item.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(pending), nil
+}
+
+// maxCollisionsListed bounds how many colliding groups checkNameKeyCollisions names
+const maxCollisionsListed = 10
+
+// checkNameKeyCollisions fails with a list of the names that share a canonical key, since the
+// unique index cannot be built over them. Soft-deleted items count, as the index covers them too.
+func checkNameKeyCollisions(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT json_group_array(name) FROM items GROUP BY tenant_id, name_key HAVING count(*) > 1 ORDER BY tenant_id, name_key")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var names string
+		if err := rows.Scan(&names); err != nil {
+			return err
+		}
+		groups = append(groups, names)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	listed := groups[:min(len(groups), maxCollisionsListed)]
+	more := ""
+	if len(groups) > len(listed) {
+		more = fmt.Sprintf(" and %d more", len(groups)-len(listed))
+	}
+	return fmt.Errorf("%d groups of existing items differ only in case or accents, so CANONICAL_NAMES cannot make them unique: %s%s; "+
+		"rename or purge all but one of each, or start with CANONICAL_NAMES=false", len(groups), strings.Join(listed, ", "), more)
+}
+
+// migrateTimestamps adds the created_at and updated_at columns. Rows that predate them have no
+// record of when they were written, so both are set to the time of the migration.
+func migrateTimestamps() error {
+	for _, column := range []string{"created_at", "updated_at"} {
+		ok, err := hasColumn("items", column)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		if _, err := getDB().Exec("ALTER TABLE items ADD COLUMN " + column + " TEXT"); err != nil {
+			return err
+		}
+		slog.Info("Added column to table 'items'", "column", column)
+	}
+
+	now := timestamp()
+	res, err := getDB().Exec("UPDATE items SET created_at = coalesce(created_at, ?), updated_at = coalesce(updated_at, ?) "+
+		"WHERE created_at IS NULL OR updated_at IS NULL", now, now)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		slog.Info("Backfilled timestamps", "items", n)
+	}
+	return nil
+}
+
+// migrateDeletedAt adds the soft-delete column; existing items stay live with a NULL deleted_at
+func migrateDeletedAt() error {
+	ok, err := hasColumn("items", "deleted_at")
+	if err != nil || ok {
+		return err
+	}
+	if _, err := getDB().Exec("ALTER TABLE items ADD COLUMN deleted_at TEXT"); err != nil {
+		return err
+	}
+	slog.Info("Added column to table 'items'", "column", "deleted_at")
+	return nil
+}
+
+// nameKey canonicalizes a display name for uniqueness checks by lowercasing it
+// and stripping accents, so "Café" and "cafe" share the key "cafe"
+func nameKey(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
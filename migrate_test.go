@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNameKey(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"Café", "cafe"},
+		{"cafe", "cafe"},
+		{"CAFÉ", "cafe"},
+		{"Crème Brûlée", "creme brulee"},
+		{"Łódź", "łodz"},
+	}
+	for _, tt := range tests {
+		if got := nameKey(tt.name); got != tt.want {
+			t.Errorf("nameKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalNamesConflict(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.CanonicalNames = true })
+	if w := serve(h, "POST", "/items", `{"name":"Café"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create Café: status %d", w.Code)
+	}
+	if w := serve(h, "POST", "/items", `{"name":"cafe"}`); w.Code != http.StatusConflict {
+		t.Errorf("create cafe: status %d, want 409", w.Code)
+	}
+}
+
+func TestCanonicalNamesOff(t *testing.T) {
+	h := setupTest(t) // off by default
+	serve(h, "POST", "/items", `{"name":"Café"}`)
+	if w := serve(h, "POST", "/items", `{"name":"cafe"}`); w.Code != http.StatusCreated {
+		t.Errorf("create cafe: status %d, want 201", w.Code)
+	}
+}
+
+// openLegacyDB opens a database with the schema from before tenant_id and name_key existed, holding names
+func openLegacyDB(t *testing.T, names ...string) {
+	t.Helper()
+	cfg = envConfig()
+	db, err := openDB("file:" + filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	dbHandle.Store(db)
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if _, err := db.Exec("INSERT INTO items (name) VALUES (?)", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateNameKeyCollisions(t *testing.T) {
+	openLegacyDB(t, "Apple", "apple", "Café", "cafe", "banana")
+	cfg.CanonicalNames = true
+	if err := migrateTenantID(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := migrateNameKey()
+	if err == nil {
+		t.Fatal("migrateNameKey succeeded over colliding names")
+	}
+	for _, want := range []string{`["Apple","apple"]`, `["Café","cafe"]`, "CANONICAL_NAMES=false"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	var filled int
+	getDB().QueryRow("SELECT count(*) FROM items WHERE name_key IS NOT NULL").Scan(&filled)
+	if filled != 0 {
+		t.Errorf("%d name_keys backfilled although the migration failed", filled)
+	}
+
+	cfg.CanonicalNames = false
+	if err := migrateNameKey(); err != nil {
+		t.Fatalf("migrateNameKey with CANONICAL_NAMES=false: %v", err)
+	}
+	getDB().QueryRow("SELECT count(*) FROM items WHERE name_key IS NOT NULL").Scan(&filled)
+	if filled != 5 {
+		t.Errorf("%d name_keys backfilled, want 5", filled)
+	}
+}
+
+func TestMigrateNameKeyWithoutCollisions(t *testing.T) {
+	openLegacyDB(t, "Apple", "banana")
+	cfg.CanonicalNames = true
+	if err := migrateTenantID(); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateNameKey(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getDB().Exec("INSERT INTO items (name, name_key) VALUES ('APPLE', 'apple')"); !isNameConflict(err) {
+		t.Errorf("insert of a colliding key: err %v, want a name conflict", err)
+	}
+}
+
+func TestMigrateTenantID(t *testing.T) {
+	openLegacyDB(t, "apple", "banana", "cherry")
+	if _, err := getDB().Exec("DELETE FROM items WHERE name = 'cherry'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateTenantID(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := getDB().Query("SELECT id, tenant_id, name FROM items ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rows.Next() {
+		var id int
+		var tenant, name string
+		rows.Scan(&id, &tenant, &name)
+		got = append(got, fmt.Sprintf("%d %q %s", id, tenant, name))
+	}
+	rows.Close()
+	if want := []string{`1 "" apple`, `2 "" banana`}; !slices.Equal(got, want) {
+		t.Errorf("rows after rebuild %q, want %q", got, want)
+	}
+
+	// The deleted id 3 must not be handed out again, and names are now unique per tenant
+	var id int
+	if err := getDB().QueryRow("INSERT INTO items (tenant_id, name) VALUES ('acme', 'apple') RETURNING id").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id != 4 {
+		t.Errorf("next id %d, want 4", id)
+	}
+	if _, err := getDB().Exec("INSERT INTO items (name) VALUES ('apple')"); !isNameConflict(err) {
+		t.Errorf("duplicate name in the default tenant: err %v, want a name conflict", err)
+	}
+	if err := migrateTenantID(); err != nil {
+		t.Errorf("second run: %v", err)
+	}
+
+	// Paging through a tenant in id order must walk an index rather than sort the table
+	rows, err = getDB().Query("EXPLAIN QUERY PLAN SELECT "+itemColumns+" FROM items WHERE tenant_id = ? AND deleted_at IS NULL ORDER BY id LIMIT 10", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		rows.Scan(&id, &parent, &unused, &detail)
+		if strings.Contains(detail, "TEMP B-TREE") {
+			t.Errorf("list query plan sorts: %s", detail)
+		}
+	}
+}
+
+func TestManageSchemaOff(t *testing.T) {
+	// Let the eager mode create a database, then reopen it with schema management off
+	setupTest(t)
+	path := cfg.DatabaseURL
+	if err := verifySchema(); err != nil {
+		t.Fatalf("schema created by initDB does not verify: %v", err)
+	}
+	primaryDB.Load().Close()
+
+	h := setupTest(t, func(c *Config) {
+		c.DatabaseURL = path
+		c.ManageSchema = false
+	})
+	createItems(t, h, "apple")
+	if w := serve(h, "POST", "/tags", `{"label":"fruit"}`); w.Code != http.StatusCreated {
+		t.Errorf("create tag: status %d, body %q", w.Code, w.Body)
+	}
+}
+
+func TestManageSchemaOffMissingTable(t *testing.T) {
+	openLegacyDB(t)
+	if err := verifySchema(); err == nil || !strings.Contains(err.Error(), "missing column") {
+		t.Errorf("verifySchema on a legacy table: %v, want a missing column", err)
+	}
+	getDB().Exec("DROP TABLE items")
+	if err := verifySchema(); err == nil {
+		t.Error("verifySchema succeeded without an items table")
+	}
+}
+
+// TestManageSchemaOffFailsFast runs initDB in a child process, since it exits on a missing schema
+func TestManageSchemaOffFailsFast(t *testing.T) {
+	if path := os.Getenv("SREST_TEST_INIT_DB"); path != "" {
+		cfg = envConfig()
+		cfg.ManageSchema = false
+		initDB(path)
+		os.Exit(0)
+	}
+
+	path := filepath.Join(t.TempDir(), "empty.db")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestManageSchemaOffFailsFast$")
+	cmd.Env = append(os.Environ(), "SREST_TEST_INIT_DB="+path)
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+		t.Fatalf("initDB with a missing schema: %v, want exit status 1\n%s", err, out)
+	}
+
+	db, err := openDB("file:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var tables int
+	db.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables)
+	if tables != 0 {
+		t.Errorf("initDB created %d tables with MANAGE_SCHEMA off", tables)
+	}
+}
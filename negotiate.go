@@ -0,0 +1,74 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiate picks the offered media type the Accept header prefers, honouring q-values and
+// wildcards. Each offer is weighted by the most specific range that matches it; ties go to the
+// earlier offer. An empty Accept header accepts the first offer. It returns "" when nothing
+// offered is acceptable.
+func negotiate(accept string, offered []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offered[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			s := matchSpecificity(mediaType, offer)
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1.0
+			if v, ok := params["q"]; ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed >= 0 && parsed <= 1 {
+					q = parsed
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// matchSpecificity reports how specifically mediaRange matches offer:
+// 2 for an exact match, 1 for type/*, 0 for */*, and -1 for no match
+func matchSpecificity(mediaRange, offer string) int {
+	switch {
+	case mediaRange == offer:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// listMediaTypes are the representations of the item list, JSON first as the default
+var listMediaTypes = []string{"application/json", "text/csv"}
+
+// requireAcceptable rejects requests with 406 in strict mode when the Accept header rules out
+// every representation the server can produce. CSV is only produced by GET /items; other routes
+// answer a text/csv-only Accept with JSON.
+func requireAcceptable(next http.Handler) http.Handler {
+	offered := listMediaTypes
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.StrictAccept && negotiate(r.Header.Get("Accept"), offered) == "" {
+			http.Error(w, "Not Acceptable: supported types are "+strings.Join(offered, ", "), http.StatusNotAcceptable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct{ accept, want string }{
+		{"", "application/json"},
+		{"application/xml;q=0.9, application/json;q=1.0", "application/json"},
+		{"application/json;q=0.5, text/csv", "text/csv"},
+		{"text/csv;q=0.8, application/json;q=0.9", "application/json"},
+		{"text/*;q=0.9, application/json;q=0.1", "text/csv"},
+		{"*/*", "application/json"},
+		{"*/*;q=0.1, text/csv;q=0", "application/json"},
+		{"application/xml", ""},
+		{"application/json;q=0, text/csv;q=0", ""},
+		{"not a media type, text/csv", "text/csv"},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept, listMediaTypes); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestStrictAccept(t *testing.T) {
+	for _, strict := range []bool{true, false} {
+		h := setupTest(t, func(c *Config) { c.StrictAccept = strict })
+
+		want := http.StatusOK
+		if strict {
+			want = http.StatusNotAcceptable
+		}
+		w := serve(h, "GET", "/items", "", "Accept", "application/xml")
+		if w.Code != want {
+			t.Errorf("strict %v: status %d, want %d", strict, w.Code, want)
+		}
+		w = serve(h, "GET", "/items", "", "Accept", "application/xml;q=0.9, text/csv;q=0.5")
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+			t.Errorf("strict %v: status %d, Content-Type %q, want CSV", strict, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// visitor is the token bucket of one client IP
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// routeLimit is the token bucket size of one route, see RATE_LIMIT_ROUTES
+type routeLimit struct {
+	RPS   int // Sustained requests per second, 0 leaves the route unlimited
+	Burst int // Requests that may be made at once
+}
+
+// routeLimits maps route patterns, as registered on the mux, to their limits
+type routeLimits map[string]routeLimit
+
+var (
+	visitorsMu sync.Mutex
+	visitors   = map[string]*visitor{}
+)
+
+// limiterFor returns the bucket for key, creating it with limit on first use
+func limiterFor(key string, limit routeLimit) *rate.Limiter {
+	visitorsMu.Lock()
+	defer visitorsMu.Unlock()
+
+	v, ok := visitors[key]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(rate.Limit(limit.RPS), limit.Burst)}
+		visitors[key] = v
+	}
+	v.lastSeen = time.Now()
+	return v.limiter
+}
+
+// evictVisitors drops buckets that have been idle for RATE_LIMIT_IDLE_TTL, so memory stays
+// bounded by the number of recently active clients. An evicted client starts with a full bucket.
+func evictVisitors(stop <-chan struct{}) {
+	ticker := time.NewTicker(cfg.RateLimitIdleTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-cfg.RateLimitIdleTTL)
+		visitorsMu.Lock()
+		for ip, v := range visitors {
+			if v.lastSeen.Before(cutoff) {
+				delete(visitors, ip)
+			}
+		}
+		visitorsMu.Unlock()
+	}
+}
+
+// clientIP returns the address rate limits are keyed on. With TRUSTED_PROXY_HOPS set, it is
+// the X-Forwarded-For entry added by the outermost trusted proxy; entries to its left were
+// supplied by the client and can be forged. Otherwise it is the connection's remote address.
+func clientIP(r *http.Request) string {
+	if hops := cfg.TrustedProxyHops; hops > 0 {
+		var hopsSeen []string
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			for _, ip := range strings.Split(h, ",") {
+				hopsSeen = append(hopsSeen, strings.TrimSpace(ip))
+			}
+		}
+		if len(hopsSeen) >= hops {
+			if ip := net.ParseIP(hopsSeen[len(hopsSeen)-hops]); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimit applies a per-IP token bucket of RATE_LIMIT_RPS requests per second with bursts of
+// RATE_LIMIT_BURST, answering 429 once a client's bucket is empty, with Retry-After set to when its next token is due. A route listed
+// in RATE_LIMIT_ROUTES, keyed by the pattern mux matches the request to, gets its own bucket per
+// IP instead, so e.g. searches can be limited harder than reads without sharing their budget.
+// The bucket's size and what is left of it are reported in X-RateLimit-Limit and
+// X-RateLimit-Remaining, and the seconds until it is full again in X-RateLimit-Reset. Rate
+// limiting is off for routes whose limit is 0 requests per second.
+func rateLimit(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := clientIP(r)
+			limit := routeLimit{RPS: cfg.RateLimitRPS, Burst: cfg.RateLimitBurst}
+			if _, pattern := mux.Handler(r); pattern != "" {
+				if l, ok := cfg.RateLimitRoutes[pattern]; ok {
+					key, limit = pattern+" "+key, l
+				}
+			}
+			if limit.RPS == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limiter := limiterFor(key, limit)
+			allowed := limiter.Allow()
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+			tokens := max(limiter.Tokens(), 0)
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(tokens)))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(limit.Burst)-tokens)/float64(limit.RPS)))))
+			if !allowed {
+				// Tell the client when its next token is due, rounded up to whole seconds. The
+				// reservation only measures the wait; cancelling returns the token to the bucket.
+				reservation := limiter.Reserve()
+				if delay := reservation.Delay(); reservation.OK() && delay != rate.InfDuration {
+					w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(delay.Seconds())), 1)))
+				} else {
+					setRetryAfter(w)
+				}
+				reservation.Cancel()
+				writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
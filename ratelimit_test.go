@@ -0,0 +1,140 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	h := setupTest(t, func(c *Config) {
+		c.RateLimitRPS, c.RateLimitBurst = 1, 2
+		c.RetryAfterMin, c.RetryAfterMax = 30, 30
+		c.CORSAllowedOrigins = []string{"https://app.example"}
+	})
+	origin := []string{"Origin", "https://app.example"}
+
+	// Preflights are answered before the limiter and do not use up the bucket
+	for range 5 {
+		w := serve(h, "OPTIONS", "/items", "", append(origin, "Access-Control-Request-Method", "GET")...)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("preflight: status %d, want 204", w.Code)
+		}
+	}
+
+	for i := range 2 {
+		if w := serve(h, "GET", "/items", "", origin...); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+	}
+	w := serve(h, "GET", "/items", "", origin...)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over the limit: status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After %q, want 1, when the next token is due", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example" {
+		t.Errorf("429 Access-Control-Allow-Origin %q, want the origin", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining %q, want 0", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Reset"); got != "2" {
+		t.Errorf("X-RateLimit-Reset %q, want 2, the seconds to refill both tokens", got)
+	}
+
+	// X-Forwarded-For picks the bucket only when the proxy is trusted
+	r := serve(h, "GET", "/items", "", "X-Forwarded-For", "198.51.100.7")
+	if r.Code != http.StatusTooManyRequests {
+		t.Errorf("untrusted X-Forwarded-For: status %d, want 429 from the shared remote address", r.Code)
+	}
+	cfg.TrustedProxyHops = 1
+	if r := serve(h, "GET", "/items", "", "X-Forwarded-For", "198.51.100.7"); r.Code != http.StatusOK {
+		t.Errorf("trusted X-Forwarded-For: status %d, want 200", r.Code)
+	}
+}
+
+func TestRateLimitRemaining(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.RateLimitRPS, c.RateLimitBurst = 5, 3 })
+
+	for want := 2; want >= 0; want-- {
+		w := serve(h, "GET", "/items", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", 3-want, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(want) {
+			t.Errorf("request %d: X-RateLimit-Remaining %q, want %d", 3-want, got, want)
+		}
+		if got := w.Header().Get("X-RateLimit-Reset"); got != "1" {
+			t.Errorf("request %d: X-RateLimit-Reset %q, want 1", 3-want, got)
+		}
+	}
+
+	// After the refill interval the bucket is full again and one request takes one token
+	time.Sleep(time.Second)
+	w := serve(h, "GET", "/items", "")
+	if got := w.Header().Get("X-RateLimit-Remaining"); w.Code != http.StatusOK || got != "2" {
+		t.Errorf("after refill: status %d, X-RateLimit-Remaining %q, want 200 and 2", w.Code, got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg = Config{TrustedProxyHops: 2}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:5000"
+	r.Header.Add("X-Forwarded-For", "203.0.113.9, 198.51.100.1")
+	r.Header.Add("X-Forwarded-For", "10.0.0.1")
+	if got := clientIP(r); got != "198.51.100.1" {
+		t.Errorf("clientIP = %q, want the entry added by the outermost trusted proxy", got)
+	}
+
+	cfg.TrustedProxyHops = 0
+	if got := clientIP(r); got != "10.0.0.2" {
+		t.Errorf("clientIP without trusted hops = %q, want the remote address", got)
+	}
+}
+
+func TestRouteRateLimits(t *testing.T) {
+	h := setupTest(t, func(c *Config) {
+		c.RateLimitRoutes = routeLimits{
+			"GET /items":                  {RPS: 1, Burst: 1},
+			"POST /items/search/advanced": {RPS: 1, Burst: 2},
+		}
+	})
+
+	if w := serve(h, "GET", "/items", ""); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "1" {
+		t.Fatalf("list: status %d, X-RateLimit-Limit %q", w.Code, w.Header().Get("X-RateLimit-Limit"))
+	}
+	if w := serve(h, "GET", "/items", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second list: status %d, want 429", w.Code)
+	}
+
+	// The exhausted list bucket leaves the search bucket untouched
+	for i := range 2 {
+		w := serve(h, "POST", "/items/search/advanced", `{}`)
+		if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Errorf("search %d: status %d, X-RateLimit-Limit %q", i+1, w.Code, w.Header().Get("X-RateLimit-Limit"))
+		}
+	}
+	if w := serve(h, "POST", "/items/search/advanced", `{}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("third search: status %d, want 429", w.Code)
+	}
+
+	// Routes without their own limit fall back to RATE_LIMIT_RPS, which is off here
+	for range 3 {
+		if w := serve(h, "GET", "/items/count", ""); w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+			t.Errorf("count: status %d, X-RateLimit-Limit %q, want unlimited", w.Code, w.Header().Get("X-RateLimit-Limit"))
+		}
+	}
+}
+
+func TestEnvRouteLimits(t *testing.T) {
+	t.Setenv("RATE_LIMIT_ROUTES", "GET /items=5:10, POST /items=1:2")
+	want := routeLimits{"GET /items": {RPS: 5, Burst: 10}, "POST /items": {RPS: 1, Burst: 2}}
+	if got := envRouteLimits("RATE_LIMIT_ROUTES"); !maps.Equal(got, want) {
+		t.Errorf("envRouteLimits = %v, want %v", got, want)
+	}
+}
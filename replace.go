@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// replaceSummary reports what POST /items/replace-all changed to match the submitted set
+type replaceSummary struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Deleted   int `json:"deleted"`
+}
+
+// replaceAllHandler makes the stored items match the submitted array exactly, keyed by name:
+// missing names are inserted, soft-deleted ones restored, live ones left as they are, and every
+// other item soft-deleted, all in one transaction. Because it deletes, the request must
+// carry ?confirm=true.
+func replaceAllHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+	if confirm, _ := strconv.ParseBool(r.URL.Query().Get("confirm")); !confirm {
+		http.Error(w, "Replacing all items deletes every item not in the request; repeat with ?confirm=true", http.StatusBadRequest)
+		return
+	}
+
+	var items []Item
+	if !decodeBody(w, r, &items) {
+		return
+	}
+	if rejectIfBatchTooLarge(w, len(items)) || rejectInvalidItems(w, items) {
+		return
+	}
+	names := make([]string, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if seen[item.Name] {
+			http.Error(w, fmt.Sprintf("Duplicate item name in request: %q", item.Name), http.StatusBadRequest)
+			return
+		}
+		seen[item.Name] = true
+		names = append(names, item.Name)
+	}
+	namesJSON, err := json.Marshal(names)
+	if err != nil {
+		http.Error(w, "Failed to encode item names", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := getDB().BeginTx(ctx, nil)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to replace items")
+		slog.ErrorContext(r.Context(), "Error beginning replace transaction", "err", err)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE items SET deleted_at = ? WHERE tenant_id = ? AND deleted_at IS NULL AND name NOT IN (SELECT value FROM json_each(?))",
+		timestamp(), tenantFrom(ctx), string(namesJSON))
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to replace items")
+		slog.ErrorContext(r.Context(), "Error deleting items not in replacement set", "err", err)
+		return
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to get rows affected")
+		slog.ErrorContext(r.Context(), "Error getting rows affected", "err", err)
+		return
+	}
+
+	var upserted upsertSummary
+	if !upsertInTx(ctx, w, tx, items, &upserted) {
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(r.Context(), w, err, "Failed to replace items")
+		slog.ErrorContext(r.Context(), "Error committing replace", "err", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(replaceSummary{
+		Created: upserted.Inserted, Updated: upserted.Updated, Unchanged: upserted.Unchanged, Deleted: int(deleted),
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestReplaceAll(t *testing.T) {
+	h := setupTest(t)
+	for _, body := range []string{`{"name":"apple"}`, `{"name":"banana"}`, `{"name":"cherry"}`} {
+		serve(h, "POST", "/items", body)
+	}
+	serve(h, "DELETE", "/items/3", "")
+
+	desired := `[{"name":"apple"},{"name":"cherry"},{"name":"date"}]`
+	if w := serve(h, "POST", "/items/replace-all", desired); w.Code != http.StatusBadRequest {
+		t.Errorf("without confirm: status %d, want 400", w.Code)
+	}
+
+	w := serve(h, "POST", "/items/replace-all?confirm=true", desired)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var got replaceSummary
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if want := (replaceSummary{Created: 1, Updated: 1, Unchanged: 1, Deleted: 1}); got != want {
+		t.Errorf("summary %+v, want %+v", got, want)
+	}
+
+	var items []Item
+	json.Unmarshal(serve(h, "GET", "/items?sort=name", "").Body.Bytes(), &items)
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	if want := []string{"apple", "cherry", "date"}; !slices.Equal(names, want) {
+		t.Errorf("items %v, want %v", names, want)
+	}
+
+	// Replaying the same set changes nothing
+	w = serve(h, "POST", "/items/replace-all?confirm=true", desired)
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if want := (replaceSummary{Unchanged: 3}); got != want {
+		t.Errorf("replay summary %+v, want %+v", got, want)
+	}
+}
+
+func TestReplaceAllRejectsDuplicates(t *testing.T) {
+	h := setupTest(t)
+	if w := serve(h, "POST", "/items/replace-all?confirm=true", `[{"name":"a"},{"name":"a"}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+}
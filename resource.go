@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Column describes one client-writable column of a resource table
+type Column struct {
+	Name     string // Column name, also the JSON field name
+	Type     string // SQL type, one of TEXT, INTEGER or REAL; selects how JSON values are decoded
+	Required bool   // NOT NULL; must be present on create and replace
+	Unique   bool   // Backed by a unique index; a duplicate is answered with 409
+}
+
+// Resource is a table served by the generic CRUD handlers at /<Name> and /<Name>/{id}. Every
+// table has an INTEGER id primary key in addition to Columns. Items keep their own handlers,
+// since soft deletes, name keys and ETags do not generalize; add other tables to resources.
+type Resource struct {
+	Name    string // URL path segment, e.g. "tags"
+	Table   string
+	Columns []Column
+}
+
+// resources are served by the generic handlers alongside items. None are defined by default;
+// each entry added here gets its table created at startup and its routes registered.
+var resources []Resource
+
+// columnDecoders turn a JSON value into the Go value bound for a column of each type
+var columnDecoders = map[string]func(json.RawMessage) (any, error){
+	"TEXT":    decodeAs[string],
+	"INTEGER": decodeAs[int64],
+	"REAL":    decodeAs[float64],
+}
+
+// decodeAs unmarshals raw into a T
+func decodeAs[T any](raw json.RawMessage) (any, error) {
+	var v T
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
+
+// identifier matches the table, column and path names resources may use, which are spliced into
+// SQL and route patterns unquoted
+var identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// validateResources checks the resource definitions, so a typo fails at startup rather than as a
+// panic or SQL error on the first request that reaches it
+func validateResources() error {
+	names := map[string]bool{"items": true}
+	tables := map[string]bool{"items": true}
+	for _, res := range resources {
+		switch {
+		case !identifier.MatchString(res.Name):
+			return fmt.Errorf("resource name %q must match %s", res.Name, identifier)
+		case !identifier.MatchString(res.Table) || strings.HasPrefix(res.Table, "sqlite_"):
+			return fmt.Errorf("resource %s: table name %q must match %s and not start with sqlite_", res.Name, res.Table, identifier)
+		case names[res.Name]:
+			return fmt.Errorf("resource name %q is used twice", res.Name)
+		case tables[res.Table]:
+			return fmt.Errorf("resource %s: table %q is used twice", res.Name, res.Table)
+		case len(res.Columns) == 0:
+			return fmt.Errorf("resource %s has no columns", res.Name)
+		}
+		names[res.Name], tables[res.Table] = true, true
+
+		columns := map[string]bool{"id": true, "tenant_id": true}
+		for _, c := range res.Columns {
+			switch {
+			case !identifier.MatchString(c.Name):
+				return fmt.Errorf("resource %s: column name %q must match %s", res.Name, c.Name, identifier)
+			case columns[c.Name]:
+				return fmt.Errorf("resource %s: column %q is used twice or is reserved", res.Name, c.Name)
+			case columnDecoders[c.Type] == nil:
+				return fmt.Errorf("resource %s: column %s has type %q, want TEXT, INTEGER or REAL", res.Name, c.Name, c.Type)
+			}
+			columns[c.Name] = true
+		}
+	}
+	return nil
+}
+
+// selectList returns the column list rows of res are selected with, id first
+func (res *Resource) selectList() string {
+	names := []string{"id"}
+	for _, c := range res.Columns {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// ensureTable creates the table of res and the unique indexes of its columns if they do not exist
+// yet. Rows belong to a tenant like items do, so unique columns are unique per tenant; a table
+// created before tenancy gets the tenant_id column, its rows going to the default tenant.
+func (res *Resource) ensureTable() error {
+	defs := []string{"id INTEGER PRIMARY KEY AUTOINCREMENT", "tenant_id TEXT NOT NULL DEFAULT ''"}
+	for _, c := range res.Columns {
+		def := c.Name + " " + c.Type
+		if c.Required {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+	}
+	if _, err := getDB().Exec("CREATE TABLE IF NOT EXISTS " + res.Table + " (" + strings.Join(defs, ", ") + ")"); err != nil {
+		return err
+	}
+	ok, err := hasColumn(res.Table, "tenant_id")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, err := getDB().Exec("ALTER TABLE " + res.Table + " ADD COLUMN tenant_id TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		slog.Info("Added column to table", "table", res.Table, "column", "tenant_id")
+	}
+	if _, err := getDB().Exec("CREATE INDEX IF NOT EXISTS idx_" + res.Table + "_tenant ON " + res.Table + " (tenant_id)"); err != nil {
+		return err
+	}
+	for _, c := range res.Columns {
+		if !c.Unique {
+			continue
+		}
+		// Replace the index from before tenancy, which made the column unique across tenants
+		stmts := []string{
+			"DROP INDEX IF EXISTS idx_" + res.Table + "_" + c.Name,
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_" + res.Table + "_tenant_" + c.Name + " ON " + res.Table + " (tenant_id, " + c.Name + ")",
+		}
+		for _, stmt := range stmts {
+			if _, err := getDB().Exec(stmt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyTable checks that an externally managed table has every column of res
+func (res *Resource) verifyTable() error {
+	for _, column := range append(strings.Split(res.selectList(), ", "), "tenant_id") {
+		ok, err := hasColumn(res.Table, column)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("table %s is missing column %q", res.Table, column)
+		}
+	}
+	return nil
+}
+
+// scanRow reads the current row into a JSON-ready map keyed by column name
+func (res *Resource) scanRow(row interface{ Scan(...any) error }) (map[string]any, error) {
+	values := make([]any, len(res.Columns)+1)
+	dest := make([]any, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	out := map[string]any{"id": values[0]}
+	for i, c := range res.Columns {
+		if b, ok := values[i+1].([]byte); ok {
+			values[i+1] = string(b)
+		}
+		out[c.Name] = values[i+1]
+	}
+	return out, nil
+}
+
+// decodeRow reads a JSON object from the body and returns a value for every column of res,
+// nil for absent optional ones. Unknown fields, mistyped values and missing required columns
+// are answered with 400 and false.
+func (res *Resource) decodeRow(w http.ResponseWriter, r *http.Request) ([]any, bool) {
+	var body map[string]json.RawMessage
+	if !decodeBody(w, r, &body) {
+		return nil, false
+	}
+
+	values := make([]any, len(res.Columns))
+	for i, c := range res.Columns {
+		raw, ok := body[c.Name]
+		delete(body, c.Name)
+		if !ok || string(raw) == "null" {
+			if c.Required {
+				http.Error(w, fmt.Sprintf("Invalid request body: %q is required", c.Name), http.StatusBadRequest)
+				return nil, false
+			}
+			continue
+		}
+		v, err := columnDecoders[c.Type](raw)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %q must be of type %s", c.Name, c.Type), http.StatusBadRequest)
+			return nil, false
+		}
+		values[i] = v
+	}
+	for name := range body {
+		http.Error(w, fmt.Sprintf("Invalid request body: unknown field %q", name), http.StatusBadRequest)
+		return nil, false
+	}
+	return values, true
+}
+
+// parseID parses the {id} path value of a resource route
+func (res *Resource) parseID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "Invalid "+res.Name+" ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// writeRowError answers a failed write, mapping unique violations to 409
+func (res *Resource) writeRowError(ctx context.Context, w http.ResponseWriter, err error, msg string) {
+	if sqliteCode(err) == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		writeJSONError(w, http.StatusConflict, "unique value already exists in "+res.Name)
+		return
+	}
+	writeDBError(ctx, w, err, msg)
+	slog.ErrorContext(ctx, "Error writing resource", "resource", res.Name, "err", err)
+}
+
+// listHandler returns a page of rows (?limit=, ?offset=) in id order
+func (res *Resource) listHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r.URL.Query(), defaultPageLimit)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := getDB().QueryContext(r.Context(), "SELECT "+res.selectList()+" FROM "+res.Table+" WHERE tenant_id = ? ORDER BY id LIMIT ? OFFSET ?",
+		tenantFrom(r.Context()), limit, offset)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to retrieve "+res.Name)
+		slog.ErrorContext(r.Context(), "Error querying resource", "resource", res.Name, "err", err)
+		return
+	}
+	defer rows.Close()
+
+	list := []map[string]any{} // Non-nil so an empty table encodes as [] rather than null
+	for rows.Next() {
+		row, err := res.scanRow(rows)
+		if err != nil {
+			writeDBError(r.Context(), w, err, "Failed to scan "+res.Name)
+			slog.ErrorContext(r.Context(), "Error scanning resource", "resource", res.Name, "err", err)
+			return
+		}
+		list = append(list, row)
+	}
+	if err := rows.Err(); err != nil {
+		writeDBError(r.Context(), w, err, "Error iterating rows")
+		slog.ErrorContext(r.Context(), "Error during row iteration", "resource", res.Name, "err", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// getHandler returns a single row by id
+func (res *Resource) getHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := res.parseID(w, r)
+	if !ok {
+		return
+	}
+
+	row, err := res.scanRow(getDB().QueryRowContext(r.Context(), "SELECT "+res.selectList()+" FROM "+res.Table+" WHERE tenant_id = ? AND id = ?", tenantFrom(r.Context()), id))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to retrieve "+res.Name)
+		slog.ErrorContext(r.Context(), "Error querying resource by ID", "resource", res.Name, "err", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, row)
+}
+
+// createHandler inserts a row and returns it with its id
+func (res *Resource) createHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	values, ok := res.decodeRow(w, r)
+	if !ok {
+		return
+	}
+
+	names := append([]string{"tenant_id"}, strings.Split(res.selectList(), ", ")[1:]...)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	row, err := res.scanRow(getDB().QueryRowContext(r.Context(),
+		"INSERT INTO "+res.Table+" ("+strings.Join(names, ", ")+") VALUES ("+placeholders+") RETURNING "+res.selectList(),
+		append([]any{tenantFrom(r.Context())}, values...)...))
+	if err != nil {
+		res.writeRowError(r.Context(), w, err, "Failed to create "+res.Name)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, row)
+}
+
+// updateHandler replaces every column of a row; optional columns absent from the body become null
+func (res *Resource) updateHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	id, ok := res.parseID(w, r)
+	if !ok {
+		return
+	}
+	values, ok := res.decodeRow(w, r)
+	if !ok {
+		return
+	}
+
+	sets := make([]string, len(res.Columns))
+	for i, c := range res.Columns {
+		sets[i] = c.Name + " = ?"
+	}
+	row, err := res.scanRow(getDB().QueryRowContext(r.Context(),
+		"UPDATE "+res.Table+" SET "+strings.Join(sets, ", ")+" WHERE tenant_id = ? AND id = ? RETURNING "+res.selectList(),
+		append(values, tenantFrom(r.Context()), id)...))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		res.writeRowError(r.Context(), w, err, "Failed to update "+res.Name)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, row)
+}
+
+// deleteHandler removes a row
+func (res *Resource) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	if rejectIfReadOnly(w) {
+		return
+	}
+
+	id, ok := res.parseID(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := getDB().ExecContext(r.Context(), "DELETE FROM "+res.Table+" WHERE tenant_id = ? AND id = ?", tenantFrom(r.Context()), id)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to delete "+res.Name)
+		slog.ErrorContext(r.Context(), "Error deleting resource", "resource", res.Name, "err", err)
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to get rows affected")
+		slog.ErrorContext(r.Context(), "Error getting rows affected", "err", err)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// registerResource wires the CRUD routes of res into mux
+func registerResource(mux *http.ServeMux, res *Resource) {
+	base := "/" + res.Name
+	mux.HandleFunc("GET "+base, cacheControl(cfg.CacheControlList, res.listHandler))
+	mux.HandleFunc("POST "+base, cacheControl(cfg.CacheControlMutation, res.createHandler))
+	mux.HandleFunc("GET "+base+"/{id}", cacheControl(cfg.CacheControlItem, res.getHandler))
+	mux.HandleFunc("PUT "+base+"/{id}", cacheControl(cfg.CacheControlMutation, res.updateHandler))
+	mux.HandleFunc("DELETE "+base+"/{id}", cacheControl(cfg.CacheControlMutation, res.deleteHandler))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// tagsResource is registered for every test by TestMain, to exercise the generic handlers
+var tagsResource = Resource{Name: "tags", Table: "tags", Columns: []Column{{Name: "label", Type: "TEXT", Required: true, Unique: true}}}
+
+func TestTagsResource(t *testing.T) {
+	h := setupTest(t)
+
+	w := serve(h, "POST", "/tags", `{"label":"fruit"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %q", w.Code, w.Body)
+	}
+	var tag map[string]any
+	json.Unmarshal(w.Body.Bytes(), &tag)
+	if tag["id"] != float64(1) || tag["label"] != "fruit" {
+		t.Errorf("created %v", tag)
+	}
+
+	tests := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{"duplicate", "POST", "/tags", `{"label":"fruit"}`, http.StatusConflict},
+		{"missing required", "POST", "/tags", `{}`, http.StatusBadRequest},
+		{"wrong type", "POST", "/tags", `{"label":3}`, http.StatusBadRequest},
+		{"unknown field", "POST", "/tags", `{"label":"x","colour":"red"}`, http.StatusBadRequest},
+		{"get", "GET", "/tags/1", "", http.StatusOK},
+		{"get missing", "GET", "/tags/9", "", http.StatusNotFound},
+		{"bad id", "GET", "/tags/x", "", http.StatusBadRequest},
+		{"update", "PUT", "/tags/1", `{"label":"fruits"}`, http.StatusOK},
+		{"update missing", "PUT", "/tags/9", `{"label":"veg"}`, http.StatusNotFound},
+		{"list", "GET", "/tags", "", http.StatusOK},
+		{"delete", "DELETE", "/tags/1", "", http.StatusNoContent},
+		{"delete again", "DELETE", "/tags/1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(h, tt.method, tt.target, tt.body); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d, body %q", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+	if w := serve(h, "GET", "/tags", ""); strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("list after delete: %q, want []", w.Body)
+	}
+}
+
+func TestValidateResources(t *testing.T) {
+	defer func(saved []Resource) { resources = saved }(resources)
+
+	label := Column{Name: "label", Type: "TEXT"}
+	tests := []struct {
+		name string
+		res  Resource
+		want string
+	}{
+		{"lowercase type", Resource{Name: "notes", Table: "notes", Columns: []Column{{Name: "body", Type: "text"}}}, `type "text"`},
+		{"bad table", Resource{Name: "notes", Table: "notes; DROP TABLE items", Columns: []Column{label}}, "table name"},
+		{"clashes with items", Resource{Name: "items", Table: "things", Columns: []Column{label}}, "used twice"},
+		{"shadows id", Resource{Name: "notes", Table: "notes", Columns: []Column{{Name: "id", Type: "INTEGER"}}}, "is reserved"},
+		{"no columns", Resource{Name: "notes", Table: "notes"}, "no columns"},
+		{"bad path", Resource{Name: "my notes", Table: "notes", Columns: []Column{label}}, "resource name"},
+	}
+	for _, tt := range tests {
+		resources = []Resource{tt.res}
+		if err := validateResources(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err %v, want one mentioning %s", tt.name, err, tt.want)
+		}
+	}
+
+	resources = []Resource{{Name: "notes", Table: "notes", Columns: []Column{label, {Name: "stars", Type: "INTEGER"}}}}
+	if err := validateResources(); err != nil {
+		t.Errorf("valid resource: %v", err)
+	}
+}
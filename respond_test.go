@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResponseBuffering(t *testing.T) {
+	h := setupTest(t, func(c *Config) {
+		c.ResponseBufferMax = 512
+		c.GzipMinBytes = 0
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	get := func() *http.Response {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/items")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		return resp
+	}
+
+	createItems(t, h, "apple", "banana")
+	if resp := get(); resp.ContentLength <= 0 || len(resp.TransferEncoding) != 0 {
+		t.Errorf("small list: Content-Length %d, Transfer-Encoding %v, want a buffered length", resp.ContentLength, resp.TransferEncoding)
+	}
+
+	for i := range 20 {
+		createItems(t, h, "item-"+strings.Repeat("x", 20)+string(rune('a'+i)))
+	}
+	if resp := get(); resp.ContentLength != -1 || !slices.Equal(resp.TransferEncoding, []string{"chunked"}) {
+		t.Errorf("large list: Content-Length %d, Transfer-Encoding %v, want streamed", resp.ContentLength, resp.TransferEncoding)
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple")
+	serve(h, "POST", "/items", `{"name":"say \"hi\", ok"}`)
+	csvAccept := []string{"Accept", "text/csv"}
+
+	w := serve(h, "GET", "/items?columns=name,id", "", csvAccept...)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("status %d: %v", w.Code, err)
+	}
+	want := [][]string{{"name", "id"}, {"apple", "1"}, {`say "hi", ok`, "2"}}
+	if !slices.EqualFunc(records, want, slices.Equal) {
+		t.Errorf("records %q, want %q", records, want)
+	}
+
+	w = serve(h, "GET", "/items", "", csvAccept...)
+	if header, _, _ := strings.Cut(w.Body.String(), "\n"); header != "id,name,created_at,updated_at,deleted_at" {
+		t.Errorf("default header %q", header)
+	}
+
+	// Exporting deleted items too marks them with their deleted_at, and leaves it empty for live ones
+	serve(h, "DELETE", "/items/1", "")
+	w = serve(h, "GET", "/items?include_deleted=true", "", csvAccept...)
+	records, _ = csv.NewReader(w.Body).ReadAll()
+	if len(records) != 3 || records[1][4] == "" || records[2][4] != "" {
+		t.Errorf("include_deleted export %q, want deleted_at set only on apple", records)
+	}
+
+	for _, columns := range []string{"id,colour", "id,id", ","} {
+		target := "/items?columns=" + columns
+		if w := serve(h, "GET", target, "", csvAccept...); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, w.Code)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+)
+
+// setRetryAfter sets a Retry-After header with a random delay in [RetryAfterMin, RetryAfterMax]
+// seconds, so clients turned away together don't all come back at the same moment
+func setRetryAfter(w http.ResponseWriter) {
+	secs := cfg.RetryAfterMin
+	if spread := cfg.RetryAfterMax - cfg.RetryAfterMin; spread > 0 {
+		secs += rand.IntN(spread + 1)
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestSetRetryAfterJitter(t *testing.T) {
+	cfg = envConfig()
+	cfg.RetryAfterMin, cfg.RetryAfterMax = 5, 8
+
+	seen := map[int]bool{}
+	for range 200 {
+		w := httptest.NewRecorder()
+		setRetryAfter(w)
+		secs, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		if err != nil || secs < 5 || secs > 8 {
+			t.Fatalf("Retry-After %q, want 5 to 8", w.Header().Get("Retry-After"))
+		}
+		seen[secs] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("200 responses all had Retry-After %v, want jitter", seen)
+	}
+
+	cfg.RetryAfterMax = 5
+	w := httptest.NewRecorder()
+	setRetryAfter(w)
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("without a spread Retry-After %q, want 5", got)
+	}
+}
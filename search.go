@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// searchField describes a column that may be queried through the advanced search body
+type searchField struct {
+	column string
+	kind   string // "int" or "string"; selects how operand values are decoded
+}
+
+// searchFields is the allowlist of queryable fields; anything else is rejected
+var searchFields = map[string]searchField{
+	"id":   {column: "id", kind: "int"},
+	"name": {column: "name", kind: "string"},
+}
+
+// searchOperators maps operator names to SQL templates, keyed by field kind
+var searchOperators = map[string]map[string]string{
+	"int": {
+		"eq": "%s = ?", "ne": "%s != ?",
+		"gt": "%s > ?", "gte": "%s >= ?",
+		"lt": "%s < ?", "lte": "%s <= ?",
+	},
+	"string": {
+		"eq": "%s = ?", "ne": "%s != ?",
+		"contains": `%s LIKE ? ESCAPE '\'`,
+		"prefix":   `%s LIKE ? ESCAPE '\'`,
+	},
+}
+
+// searchSort is one ORDER BY term of an advanced search
+type searchSort struct {
+	Field string `json:"field"`
+	Dir   string `json:"dir"`
+}
+
+// searchResult is the paginated response of an advanced search
+type searchResult struct {
+	Items  []Item `json:"items"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// advancedSearchHandler runs a structured JSON query compiled to parameterized SQL
+func advancedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var body map[string]json.RawMessage
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	filter, orderBy, limit, offset, err := compileSearch(tenantFrom(r.Context()), body)
+	if err != nil {
+		http.Error(w, "Invalid search: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := searchResult{Items: []Item{}, Limit: limit, Offset: offset}
+	var total int
+	err = getDB().QueryRowContext(r.Context(), "SELECT COUNT(*) FROM items"+filter.where(), filter.args...).Scan(&total)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to search items")
+		slog.ErrorContext(r.Context(), "Error counting search results", "err", err)
+		return
+	}
+	result.Total = total
+
+	args := append(filter.args, limit, offset)
+	rows, err := getDB().QueryContext(r.Context(), "SELECT "+itemColumns+" FROM items"+filter.where()+orderBy+" LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		writeDBError(r.Context(), w, err, "Failed to search items")
+		slog.ErrorContext(r.Context(), "Error querying search results", "err", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		if err := rows.Scan(item.fields()...); err != nil {
+			writeDBError(r.Context(), w, err, "Failed to scan item")
+			slog.ErrorContext(r.Context(), "Error scanning item", "err", err)
+			return
+		}
+		result.Items = append(result.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		writeDBError(r.Context(), w, err, "Error iterating rows")
+		slog.ErrorContext(r.Context(), "Error during row iteration", "err", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// compileSearch validates a search body against the field and operator allowlists and
+// returns the WHERE filter over tenant's items, ORDER BY clause, and page bounds it describes
+func compileSearch(tenant string, body map[string]json.RawMessage) (filter *itemFilter, orderBy string, limit, offset int, err error) {
+	filter = newItemFilter(tenant)
+	filter.add("deleted_at IS NULL")
+	limit = defaultPageLimit
+
+	for key, raw := range body {
+		switch key {
+		case "limit":
+			if err := json.Unmarshal(raw, &limit); err != nil || limit < 1 || limit > maxPageLimit {
+				return nil, "", 0, 0, fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit)
+			}
+		case "offset":
+			if err := json.Unmarshal(raw, &offset); err != nil || offset < 0 {
+				return nil, "", 0, 0, fmt.Errorf("offset must be a non-negative integer")
+			}
+		case "sort":
+			var terms []searchSort
+			if err := json.Unmarshal(raw, &terms); err != nil {
+				return nil, "", 0, 0, fmt.Errorf("sort must be an array of {field, dir}")
+			}
+			var parts []string
+			for _, t := range terms {
+				f, ok := searchFields[t.Field]
+				if !ok {
+					return nil, "", 0, 0, fmt.Errorf("unknown sort field %q", t.Field)
+				}
+				switch strings.ToLower(t.Dir) {
+				case "", "asc":
+					parts = append(parts, f.column+" ASC")
+				case "desc":
+					parts = append(parts, f.column+" DESC")
+				default:
+					return nil, "", 0, 0, fmt.Errorf("invalid sort direction %q", t.Dir)
+				}
+			}
+			if len(parts) > 0 {
+				orderBy = " ORDER BY " + strings.Join(parts, ", ")
+			}
+		default:
+			f, ok := searchFields[key]
+			if !ok {
+				return nil, "", 0, 0, fmt.Errorf("unknown field %q", key)
+			}
+			if err := compileCondition(filter, f, key, raw); err != nil {
+				return nil, "", 0, 0, err
+			}
+		}
+	}
+
+	if orderBy == "" {
+		orderBy = " ORDER BY id ASC" // Stable pagination without an explicit sort
+	}
+	return filter, orderBy, limit, offset, nil
+}
+
+// compileCondition adds one field's {"op": value, ...} object to the filter
+func compileCondition(filter *itemFilter, f searchField, key string, raw json.RawMessage) error {
+	var ops map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &ops); err != nil {
+		return fmt.Errorf("%s must be an object of operators", key)
+	}
+	for op, rawVal := range ops {
+		tmpl, ok := searchOperators[f.kind][op]
+		if !ok {
+			return fmt.Errorf("unknown operator %q for %s", op, key)
+		}
+
+		var val any
+		switch f.kind {
+		case "int":
+			var n int
+			if err := json.Unmarshal(rawVal, &n); err != nil {
+				return fmt.Errorf("%s.%s expects an integer", key, op)
+			}
+			val = n
+		case "string":
+			var s string
+			if err := json.Unmarshal(rawVal, &s); err != nil {
+				return fmt.Errorf("%s.%s expects a string", key, op)
+			}
+			switch op {
+			case "contains":
+				s = "%" + likeEscaper.Replace(s) + "%"
+			case "prefix":
+				s = likeEscaper.Replace(s) + "%"
+			}
+			val = s
+		}
+		filter.add(fmt.Sprintf(tmpl, f.column), val)
+	}
+	return nil
+}
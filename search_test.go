@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAdvancedSearch(t *testing.T) {
+	h := setupTest(t)
+	createItems(t, h, "apple", "pineapple", "banana", "crab apple", "grape", "apple pie", "50%_apple")
+
+	body := `{"name":{"contains":"apple"},"id":{"gt":1,"lte":6},"sort":[{"field":"name","dir":"desc"}],"limit":2,"offset":1}`
+	w := serve(h, "POST", "/items/search/advanced", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %q", w.Code, w.Body)
+	}
+	var got searchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range got.Items {
+		names = append(names, item.Name)
+	}
+	// pineapple, crab apple and apple pie match; sorted by name descending and skipping one
+	if want := []string{"crab apple", "apple pie"}; !slices.Equal(names, want) {
+		t.Errorf("items %q, want %q", names, want)
+	}
+	if got.Total != 3 || got.Limit != 2 || got.Offset != 1 {
+		t.Errorf("total %d, limit %d, offset %d, want 3, 2, 1", got.Total, got.Limit, got.Offset)
+	}
+
+	w = serve(h, "POST", "/items/search/advanced", `{"name":{"prefix":"50%_"}}`)
+	if !strings.Contains(w.Body.String(), `"total":1`) {
+		t.Errorf("LIKE wildcards in an operand were not escaped: %q", w.Body)
+	}
+}
+
+func TestAdvancedSearchRejects(t *testing.T) {
+	h := setupTest(t)
+
+	tests := []struct{ name, body string }{
+		{"unknown field", `{"colour":{"eq":"red"}}`},
+		{"unknown operator", `{"name":{"gt":"a"}}`},
+		{"wrong operand type", `{"id":{"gt":"five"}}`},
+		{"unknown sort field", `{"sort":[{"field":"deleted_at","dir":"asc"}]}`},
+		{"bad sort direction", `{"sort":[{"field":"name","dir":"sideways"}]}`},
+		{"injection in field", `{"name; DROP TABLE items":{"eq":"x"}}`},
+	}
+	for _, tt := range tests {
+		if w := serve(h, "POST", "/items/search/advanced", tt.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400, body %q", tt.name, w.Code, w.Body)
+		}
+	}
+}
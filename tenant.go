@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// tenantHeader names the tenant a request acts for
+const tenantHeader = "X-Tenant-ID"
+
+// tenantPattern matches valid tenant ids: a lowercase DNS label, so the same id works as a subdomain
+var tenantPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// tenantlessPaths serve the process as a whole and need no tenant, like /admin/ endpoints
+var tenantlessPaths = map[string]bool{"/": true, "/healthz": true, "/readyz": true, "/stats": true, "/metrics": true}
+
+type tenantKey struct{}
+
+// tenantFrom returns the tenant stored by resolveTenant. The empty string is the default tenant,
+// which holds the data written before tenancy was in use.
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// requestTenant returns the tenant named by the X-Tenant-ID header or, with TENANT_DOMAIN set, by
+// the subdomain of the Host the request was sent to. It is empty when neither names one, and an
+// error when an id is malformed or the two disagree.
+func requestTenant(r *http.Request) (string, error) {
+	tenant := strings.ToLower(strings.TrimSpace(r.Header.Get(tenantHeader)))
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return "", errors.New(tenantHeader + " must be a lowercase DNS label")
+	}
+
+	if cfg.TenantDomain == "" {
+		return tenant, nil
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	sub, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(cfg.TenantDomain))
+	if !ok {
+		return tenant, nil
+	}
+	if !tenantPattern.MatchString(sub) {
+		return "", errors.New("the subdomain naming the tenant must be a single lowercase DNS label")
+	}
+	if tenant != "" && tenant != sub {
+		return "", errors.New(tenantHeader + " does not match the tenant subdomain")
+	}
+	return sub, nil
+}
+
+// resolveTenant stores the request's tenant in its context, where every query on items and
+// resources reads it, so each tenant sees only its own rows. A request naming no tenant uses the
+// default tenant, or is rejected with 400 when TENANT_REQUIRED is set. Tenants are not tied to
+// API keys: any client holding a key may act for any tenant. Responses vary by X-Tenant-ID so a
+// cache never hands one tenant's page to another.
+func resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tenantlessPaths[r.URL.Path] && !strings.HasPrefix(r.URL.Path, "/admin/") {
+			w.Header().Add("Vary", tenantHeader)
+		}
+		tenant, err := requestTenant(r)
+		if err != nil {
+			http.Error(w, "Invalid tenant: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if tenant == "" && cfg.TenantRequired && !tenantlessPaths[r.URL.Path] && !strings.HasPrefix(r.URL.Path, "/admin/") {
+			http.Error(w, "A tenant is required: send "+tenantHeader, http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant)))
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// itemNames lists the names in a GET /items response
+func itemNames(t *testing.T, body []byte) []string {
+	t.Helper()
+	var items []Item
+	if err := json.Unmarshal(body, &items); err != nil {
+		t.Fatalf("decoding %q: %v", body, err)
+	}
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	return names
+}
+
+func TestTenantIsolation(t *testing.T) {
+	h := setupTest(t)
+
+	for _, tenant := range []string{"acme", "globex"} {
+		if w := serve(h, "POST", "/items", `{"name":"apple"}`, tenantHeader, tenant); w.Code != http.StatusCreated {
+			t.Fatalf("create in %s: status %d, body %q", tenant, w.Code, w.Body)
+		}
+	}
+	serve(h, "POST", "/items", `{"name":"banana"}`, tenantHeader, "acme")
+
+	if got := itemNames(t, serve(h, "GET", "/items", "", tenantHeader, "acme").Body.Bytes()); len(got) != 2 {
+		t.Errorf("acme lists %q, want apple and banana", got)
+	}
+	if got := itemNames(t, serve(h, "GET", "/items", "", tenantHeader, "globex").Body.Bytes()); len(got) != 1 || got[0] != "apple" {
+		t.Errorf("globex lists %q, want [apple]", got)
+	}
+	if got := itemNames(t, serve(h, "GET", "/items", "").Body.Bytes()); len(got) != 0 {
+		t.Errorf("default tenant lists %q, want none", got)
+	}
+
+	// Item 2 is globex's apple: acme can neither see nor change it
+	tests := []struct {
+		name, method, target, body string
+		want                       int
+	}{
+		{"get", "GET", "/items/2", "", http.StatusNotFound},
+		{"update", "PUT", "/items/2", `{"name":"pear"}`, http.StatusNotFound},
+		{"patch", "PATCH", "/items/2", `{"name":"pear"}`, http.StatusNotFound},
+		{"delete", "DELETE", "/items/2", "", http.StatusNotFound},
+		{"by name", "GET", "/items/by-name?name=banana", "", http.StatusOK},
+		{"count", "GET", "/items/count", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(h, tt.method, tt.target, tt.body, tenantHeader, "acme"); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d, body %q", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+	if w := serve(h, "GET", "/items/2/exists", "", tenantHeader, "acme"); w.Body.String() != `{"exists":false}`+"\n" {
+		t.Errorf("acme exists for globex's item: %q", w.Body)
+	}
+	if w := serve(h, "GET", "/items/by-name?name=banana", "", tenantHeader, "globex"); w.Code != http.StatusNotFound {
+		t.Errorf("globex by name banana: status %d, want 404", w.Code)
+	}
+	if w := serve(h, "GET", "/items/count", "", tenantHeader, "globex"); w.Body.String() != `{"count":1}`+"\n" {
+		t.Errorf("globex count %q", w.Body)
+	}
+	if w := serve(h, "GET", "/items/2", "", tenantHeader, "globex"); w.Code != http.StatusOK {
+		t.Errorf("globex get own item: status %d", w.Code)
+	}
+
+	// Resources are scoped the same way
+	if w := serve(h, "POST", "/tags", `{"label":"fruit"}`, tenantHeader, "acme"); w.Code != http.StatusCreated {
+		t.Fatalf("create tag: status %d, body %q", w.Code, w.Body)
+	}
+	if w := serve(h, "POST", "/tags", `{"label":"fruit"}`, tenantHeader, "globex"); w.Code != http.StatusCreated {
+		t.Errorf("same label in another tenant: status %d, body %q", w.Code, w.Body)
+	}
+	if w := serve(h, "GET", "/tags/1", "", tenantHeader, "globex"); w.Code != http.StatusNotFound {
+		t.Errorf("globex get acme's tag: status %d, want 404", w.Code)
+	}
+	if w := serve(h, "DELETE", "/tags/1", "", tenantHeader, "globex"); w.Code != http.StatusNotFound {
+		t.Errorf("globex delete acme's tag: status %d, want 404", w.Code)
+	}
+}
+
+func TestTenantResponsesNotShared(t *testing.T) {
+	h := setupTest(t)
+	serve(h, "POST", "/items", `{"name":"apple"}`, tenantHeader, "acme")
+
+	w := serve(h, "GET", "/items", "", tenantHeader, "acme")
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "private") || strings.Contains(cc, "public") {
+		t.Errorf("list Cache-Control %q, want a private response a shared cache will not store", cc)
+	}
+	if vary := w.Header().Values("Vary"); !slices.Contains(vary, tenantHeader) {
+		t.Errorf("list Vary %q, want %s", vary, tenantHeader)
+	}
+	if vary := serve(h, "GET", "/healthz", "").Header().Values("Vary"); slices.Contains(vary, tenantHeader) {
+		t.Errorf("/healthz Vary %q, want no %s on a tenantless path", vary, tenantHeader)
+	}
+}
+
+func TestTenantSubdomain(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.TenantDomain = "example.com" })
+
+	if w := serve(h, "POST", "http://acme.example.com/items", `{"name":"apple"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %q", w.Code, w.Body)
+	}
+	if got := itemNames(t, serve(h, "GET", "/items", "", tenantHeader, "acme").Body.Bytes()); len(got) != 1 {
+		t.Errorf("acme by header lists %q, want [apple]", got)
+	}
+	if got := itemNames(t, serve(h, "GET", "http://globex.example.com:8080/items", "").Body.Bytes()); len(got) != 0 {
+		t.Errorf("globex by subdomain lists %q, want none", got)
+	}
+	if got := itemNames(t, serve(h, "GET", "http://example.com/items", "").Body.Bytes()); len(got) != 0 {
+		t.Errorf("bare domain lists %q, want none", got)
+	}
+	if w := serve(h, "GET", "http://acme.example.com/items", "", tenantHeader, "globex"); w.Code != http.StatusBadRequest {
+		t.Errorf("header and subdomain disagree: status %d, want 400", w.Code)
+	}
+	if w := serve(h, "GET", "http://a.b.example.com/items", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("nested subdomain: status %d, want 400", w.Code)
+	}
+}
+
+func TestTenantRequired(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.TenantRequired = true })
+
+	tests := []struct {
+		name, target, tenant string
+		want                 int
+	}{
+		{"missing", "/items", "", http.StatusBadRequest},
+		{"present", "/items", "acme", http.StatusOK},
+		{"upper case folded", "/items", "ACME", http.StatusOK},
+		{"invalid", "/items", "acme_corp", http.StatusBadRequest},
+		{"leading hyphen", "/items", "-acme", http.StatusBadRequest},
+		{"resource", "/tags", "", http.StatusBadRequest},
+		{"healthz", "/healthz", "", http.StatusOK},
+		{"metrics", "/metrics", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		var headers []string
+		if tt.tenant != "" {
+			headers = []string{tenantHeader, tt.tenant}
+		}
+		if w := serve(h, "GET", tt.target, "", headers...); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d, body %q", tt.name, w.Code, tt.want, w.Body)
+		}
+	}
+}
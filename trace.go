@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// traceContext is the W3C trace context of the request being served
+type traceContext struct {
+	TraceID string // 32 hex digits, shared by every hop of the trace
+	SpanID  string // 16 hex digits identifying this server's handling of the request
+	Flags   string // 2 hex digits, passed through from the caller
+}
+
+// traceparent renders t as a version 00 traceparent header naming this request's span as the parent
+func (t traceContext) traceparent() string {
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+type traceKey struct{}
+
+// traceFrom returns the trace context stored by traceRequests, if any
+func traceFrom(ctx context.Context) (traceContext, bool) {
+	t, ok := ctx.Value(traceKey{}).(traceContext)
+	return t, ok
+}
+
+// parseTraceparent extracts the trace id and flags from a traceparent header, rejecting anything
+// malformed or using the all-zero ids the spec reserves as invalid. Versions after 00 may append
+// fields, which are ignored.
+func parseTraceparent(h string) (traceID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || (parts[0] == "00" && len(parts) != 4) {
+		return "", "", false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || !isLowerHex(traceID, 32) || !isLowerHex(parentID, 16) || !isLowerHex(flags, 2) {
+		return "", "", false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(parentID, "0") == "" {
+		return "", "", false
+	}
+	return traceID, flags, true
+}
+
+// isLowerHex reports whether s is exactly n lowercase hex digits
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// newTraceID returns n random bytes as lowercase hex
+func newTraceID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceRequests continues the caller's trace when a valid traceparent header is present, or
+// starts a new one, and echoes the resulting traceparent on the response. The trace id is the
+// request's correlation id in logs and is forwarded on outgoing requests.
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID, flags, ok := parseTraceparent(r.Header.Get("traceparent"))
+		if !ok {
+			traceID, flags = newTraceID(16), "00"
+		}
+		t := traceContext{TraceID: traceID, SpanID: newTraceID(8), Flags: flags}
+		w.Header().Set("traceparent", t.traceparent())
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), traceKey{}, t)))
+	})
+}
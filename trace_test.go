@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLogs sends JSON logs through contextHandler into the returned buffer until the test ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(contextHandler{slog.NewJSONHandler(&buf, nil)}))
+	t.Cleanup(func() { slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil))) })
+	return &buf
+}
+
+// logLines decodes the JSON log lines in buf whose msg is msg
+func logLines(t *testing.T, buf *bytes.Buffer, msg string) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		if rec["msg"] == msg {
+			lines = append(lines, rec)
+		}
+	}
+	return lines
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"garbage", false},
+	}
+	for _, tt := range tests {
+		if _, _, ok := parseTraceparent(tt.header); ok != tt.ok {
+			t.Errorf("parseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.ok)
+		}
+	}
+}
+
+func TestTraceIDPropagation(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	outgoing := make(chan string, 1)
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outgoing <- r.Header.Get("traceparent")
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer src.Close()
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outgoing <- r.Header.Get("traceparent")
+	}))
+	defer webhook.Close()
+
+	h := setupTest(t, func(c *Config) {
+		c.ImportAllowPrivate = true
+		c.DiskFullWebhook = webhook.URL
+	})
+	lastDiskFullAlert.Store(0)
+	logs := captureLogs(t)
+
+	w := serve(h, "POST", "/items/import-url", `{"url":"`+src.URL+`"}`,
+		"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502", w.Code)
+	}
+
+	// The trace id is reused for the response, the outgoing fetch, and every log line
+	if got := w.Header().Get("traceparent"); !strings.HasPrefix(got, "00-"+traceID+"-") {
+		t.Errorf("response traceparent %q does not carry the incoming trace id", got)
+	}
+	if got := <-outgoing; !strings.HasPrefix(got, "00-"+traceID+"-") || strings.Contains(got, "00f067aa0ba902b7") {
+		t.Errorf("outgoing traceparent %q, want the trace id with this server's span", got)
+	}
+	for _, msg := range []string{"Error fetching import", "Request"} {
+		lines := logLines(t, logs, msg)
+		if len(lines) != 1 || lines[0]["trace_id"] != traceID {
+			t.Errorf("%q log lines %v, want one with trace_id %s", msg, lines, traceID)
+		}
+	}
+
+	// A write failing on a full disk carries the trace id into the webhook alert it raises
+	capDatabase(t)
+	for i := 0; ; i++ {
+		w := serve(h, "POST", "/items", fmt.Sprintf(`{"name":"%s-%d"}`, strings.Repeat("x", 200), i),
+			"traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+		if w.Code == http.StatusInsufficientStorage {
+			break
+		}
+		if w.Code != http.StatusCreated || i == 200 {
+			t.Fatalf("insert %d: status %d, want 201 until the disk is full", i, w.Code)
+		}
+	}
+	select {
+	case got := <-outgoing:
+		if !strings.HasPrefix(got, "00-"+traceID+"-") || strings.Contains(got, "00f067aa0ba902b7") {
+			t.Errorf("disk full alert traceparent %q, want the trace id with this server's span", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no disk full alert was sent")
+	}
+}
+
+func TestTraceIDGenerated(t *testing.T) {
+	h := setupTest(t)
+	w := serve(h, "GET", "/", "", "traceparent", "not-a-traceparent")
+	traceID, _, ok := parseTraceparent(w.Header().Get("traceparent"))
+	if !ok {
+		t.Fatalf("response traceparent %q is not valid", w.Header().Get("traceparent"))
+	}
+	if other, _, _ := parseTraceparent(serve(h, "GET", "/", "").Header().Get("traceparent")); other == traceID {
+		t.Error("two requests without a traceparent got the same trace id")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// validateItem normalizes item before it is written, trimming whitespace around the name, and
+// rejects names that are then empty or longer than MAX_NAME_LENGTH characters. Every handler
+// that stores a name goes through it so the rules cannot drift apart.
+func validateItem(item *Item) error {
+	item.Name = strings.TrimSpace(item.Name)
+	if item.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	if n := utf8.RuneCountInString(item.Name); n > cfg.MaxNameLength {
+		return fmt.Errorf("name is %d characters long, the maximum is %d", n, cfg.MaxNameLength)
+	}
+	return nil
+}
+
+// rejectInvalidItem validates item, responding with 400 and returning true when it is invalid
+func rejectInvalidItem(w http.ResponseWriter, item *Item) bool {
+	if err := validateItem(item); err != nil {
+		http.Error(w, "Invalid item: "+err.Error(), http.StatusBadRequest)
+		return true
+	}
+	return false
+}
+
+// rejectInvalidItems validates every item of a batch in place, responding with 400 naming the
+// first invalid one's index and returning true if there is one
+func rejectInvalidItems(w http.ResponseWriter, items []Item) bool {
+	for i := range items {
+		if err := validateItem(&items[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid item at index %d: %v", i, err), http.StatusBadRequest)
+			return true
+		}
+	}
+	return false
+}
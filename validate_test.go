@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestValidateItem(t *testing.T) {
+	cfg = envConfig()
+	cfg.MaxNameLength = 10
+
+	tests := []struct {
+		name, in, want, wantErr string
+	}{
+		{"valid", "apple", "apple", ""},
+		{"trimmed", "  apple\t\n", "apple", ""},
+		{"empty", "", "", "must not be empty"},
+		{"whitespace only", " \t\n ", "", "must not be empty"},
+		{"at the limit", "abcdefghij", "abcdefghij", ""},
+		{"limit counts characters", "ééééééééé鸡", "ééééééééé鸡", ""},
+		{"too long", "abcdefghijk", "", "11 characters long, the maximum is 10"},
+		{"too long after trimming", "  abcdefghijk  ", "", "11 characters long"},
+		{"padding does not count", "  abcdefghij  ", "abcdefghij", ""},
+	}
+	for _, tt := range tests {
+		item := Item{Name: tt.in}
+		err := validateItem(&item)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+		case tt.wantErr == "" && item.Name != tt.want:
+			t.Errorf("%s: name %q, want %q", tt.name, item.Name, tt.want)
+		}
+	}
+}
+
+func TestItemNameValidation(t *testing.T) {
+	h := setupTest(t, func(c *Config) { c.MaxNameLength = 10 })
+	createItems(t, h, "seed")
+
+	bodies := map[string]string{
+		"empty":           `{"name":""}`,
+		"whitespace only": `{"name":"   "}`,
+		"too long":        `{"name":"abcdefghijk"}`,
+	}
+	routes := []struct{ method, target string }{
+		{"POST", "/items"},
+		{"PUT", "/items/1"},
+		{"PATCH", "/items/1"},
+	}
+	for _, route := range routes {
+		for name, body := range bodies {
+			if w := serve(h, route.method, route.target, body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Invalid item: name") {
+				t.Errorf("%s %s, %s: status %d, body %q, want 400", route.method, route.target, name, w.Code, w.Body)
+			}
+		}
+	}
+
+	w := serve(h, "PUT", "/items/1", `{"name":"  pear  "}`)
+	var item Item
+	json.Unmarshal(w.Body.Bytes(), &item)
+	if w.Code != http.StatusOK || item.Name != "pear" {
+		t.Errorf("update with padding: status %d, name %q, want pear", w.Code, item.Name)
+	}
+	w = serve(h, "POST", "/items", `{"name":" plum "}`)
+	json.Unmarshal(w.Body.Bytes(), &item)
+	if w.Code != http.StatusCreated || item.Name != "plum" {
+		t.Errorf("create with padding: status %d, name %q, want plum", w.Code, item.Name)
+	}
+}